@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/janmarkuslanger/club-portal/internal/site"
 	"github.com/janmarkuslanger/club-portal/internal/store"
@@ -17,26 +23,62 @@ const (
 )
 
 func main() {
+	rollback := flag.Bool("rollback", false, "serve the previous build again instead of building")
+	list := flag.Bool("releases", false, "list kept builds instead of building")
+	flag.Parse()
+
 	dataPath := envOrDefault("DATA_PATH", defaultDataPath)
 	outputDir := envOrDefault("OUTPUT_DIR", defaultOutputDir)
 	templateDir := envOrDefault("TEMPLATE_DIR", defaultTemplateDir)
 	assetDir := envOrDefault("ASSET_DIR", defaultAssetDir)
 
+	switch {
+	case *rollback:
+		release, err := site.Rollback(outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("rolled back %s to build %s", outputDir, release)
+		return
+	case *list:
+		releases, current, err := site.Releases(outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, release := range releases {
+			marker := " "
+			if release == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, release)
+		}
+		return
+	}
+
 	storeInstance, err := store.NewStore(dataPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// An interrupted build is discarded and the served output stays as it was.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	clubs := storeInstance.AllClubs()
-	if err := site.Build(clubs, site.BuildOptions{
+	report, err := site.Build(ctx, clubs, site.BuildOptions{
 		OutputDir:   outputDir,
 		TemplateDir: templateDir,
 		AssetDir:    assetDir,
-	}); err != nil {
+		Incremental: envBool("BUILD_INCREMENTAL", true),
+
+		KeepReleases: envInt("BUILD_KEEP_RELEASES", site.DefaultKeepReleases),
+	})
+	if err != nil {
 		log.Fatal(err)
 	}
 
-	log.Printf("static site built: %d clubs -> %s", len(clubs), outputDir)
+	log.Printf("static site built: %d clubs (%d rendered, %d unchanged) -> %s",
+		len(clubs), report.Rendered, report.Skipped, outputDir)
 }
 
 func envOrDefault(key, fallback string) string {
@@ -46,3 +88,27 @@ func envOrDefault(key, fallback string) string {
 	}
 	return value
 }
+
+func envBool(key string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func envInt(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
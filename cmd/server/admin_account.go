@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/mail"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+	"github.com/janmarkuslanger/graft/router"
+)
+
+func handleAccount(ctx router.Context, deps adminDeps) {
+	userID, ok := sessionUserID(deps.Sessions, ctx.Request)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	info := ""
+	switch ctx.Request.URL.Query().Get("done") {
+	case "email":
+		info = "E-Mail-Adresse geaendert. Bitte bestaetige die neue Adresse ueber den Link, den wir dir geschickt haben."
+	case "password":
+		info = "Passwort geaendert. Alle anderen Sitzungen wurden abgemeldet."
+	case "delete":
+		info = "Die Loeschung deines Kontos ist vorgemerkt."
+	case "restore":
+		info = "Die Loeschung wurde abgebrochen."
+	}
+	renderAccount(ctx, deps, userID, "", info, "")
+}
+
+func handleAccountEmail(ctx router.Context, deps adminDeps) {
+	userID, ok := sessionUserID(deps.Sessions, ctx.Request)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	previous, ok := deps.Store.GetUser(userID)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	newEmail := ctx.Request.FormValue("email")
+	var user store.User
+	err := confirmPassword(deps, previous.Email, func() error {
+		var err error
+		user, err = deps.Store.ChangeEmail(userID, ctx.Request.FormValue("password"), newEmail)
+		return err
+	})
+	if err != nil {
+		renderAccount(ctx, deps, userID, accountErrorMessage(err, deps.Store.PasswordPolicy()), "", newEmail)
+		return
+	}
+
+	// The new address is unverified, which can take the club page offline
+	// until it is confirmed.
+	if club, hasClub := deps.Store.GetClubForUser(userID); hasClub {
+		if err := deps.Store.EnqueueClubBuildTask(club.ID, 0); err != nil {
+			log.Printf("failed to enqueue build task: %v", err)
+		}
+	}
+
+	if err := deps.Verifier.Send(user); err != nil {
+		log.Printf("failed to send verification mail: %v", err)
+	}
+	if err := deps.Mailer.Send(mail.Message{
+		To:      previous.Email,
+		Subject: appName() + ": E-Mail-Adresse geaendert",
+		Body: "Hallo,\n\n" +
+			"die Login-Adresse deines Kontos wurde auf " + user.Email + " geaendert.\n" +
+			"Wenn du das nicht warst, melde dich bitte umgehend bei uns.\n",
+	}); err != nil {
+		log.Printf("failed to send email change notice: %v", err)
+	}
+
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/account?done=email", http.StatusSeeOther)
+}
+
+func handleAccountPassword(ctx router.Context, deps adminDeps) {
+	userID, ok := sessionUserID(deps.Sessions, ctx.Request)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	password := ctx.Request.FormValue("new_password")
+	if password != ctx.Request.FormValue("new_password_confirm") {
+		renderAccount(ctx, deps, userID, "Die Passwoerter stimmen nicht ueberein.", "", "")
+		return
+	}
+
+	user, ok := deps.Store.GetUser(userID)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	err := confirmPassword(deps, user.Email, func() error {
+		return deps.Store.ChangePassword(userID, ctx.Request.FormValue("current_password"), password)
+	})
+	if err != nil {
+		renderAccount(ctx, deps, userID, accountErrorMessage(err, deps.Store.PasswordPolicy()), "", "")
+		return
+	}
+
+	// Revoke every session, including this one, and hand the browser a fresh
+	// token so that only the device that changed the password stays logged in.
+	if err := deps.Sessions.DeleteUser(userID); err != nil {
+		log.Printf("failed to revoke sessions after password change: %v", err)
+	}
+	sessionToken, err := deps.Sessions.Create(userID)
+	if err != nil {
+		clearSessionCookie(ctx.Writer, deps.CookieSecure)
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	setSessionCookie(ctx.Writer, sessionToken, deps.CookieSecure)
+
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/account?done=password", http.StatusSeeOther)
+}
+
+func handleAccountExport(ctx router.Context, deps adminDeps) {
+	userID, ok := sessionUserID(deps.Sessions, ctx.Request)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	export, err := deps.Store.ExportAccount(userID)
+	if err != nil {
+		log.Printf("account export failed: %v", err)
+		http.Error(ctx.Writer, "export failed", http.StatusInternalServerError)
+		return
+	}
+
+	ctx.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	ctx.Writer.Header().Set("Content-Disposition", `attachment; filename="club-portal-export.json"`)
+	ctx.Writer.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(ctx.Writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		log.Printf("account export write failed: %v", err)
+	}
+}
+
+func handleAccountDelete(ctx router.Context, deps adminDeps) {
+	userID, ok := sessionUserID(deps.Sessions, ctx.Request)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := deps.Store.GetUser(userID)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	deleteAt := time.Now().Add(deps.DeletionGrace)
+	err := confirmPassword(deps, user.Email, func() error {
+		return deps.Store.ScheduleAccountDeletion(userID, ctx.Request.FormValue("password"), deleteAt)
+	})
+	if err != nil {
+		renderAccount(ctx, deps, userID, accountErrorMessage(err, deps.Store.PasswordPolicy()), "", "")
+		return
+	}
+
+	if deps.DeletionGrace <= 0 {
+		purgeDeletedAccounts(deps.Store, deps.BuildDebounce)
+		clearSessionCookie(ctx.Writer, deps.CookieSecure)
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/account?done=delete", http.StatusSeeOther)
+}
+
+func handleAccountDeleteCancel(ctx router.Context, deps adminDeps) {
+	userID, ok := sessionUserID(deps.Sessions, ctx.Request)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := deps.Store.CancelAccountDeletion(userID); err != nil && !errors.Is(err, store.ErrDeletionNotScheduled) {
+		renderAccount(ctx, deps, userID, "Abbrechen fehlgeschlagen.", "", "")
+		return
+	}
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/account?done=restore", http.StatusSeeOther)
+}
+
+func renderAccount(ctx router.Context, deps adminDeps, userID, errMsg, info, newEmail string) {
+	user, ok := deps.Store.GetUser(userID)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := accountData{
+		AppName:           appName(),
+		CSRFToken:         csrfToken(ctx.Request),
+		Title:             "Konto",
+		Error:             errMsg,
+		Info:              info,
+		Email:             user.Email,
+		NewEmail:          newEmail,
+		NeedsVerification: !user.Verified(),
+		PasswordHint:      passwordHint(deps.Store.PasswordPolicy()),
+		DeletionGrace:     durationLabel(deps.DeletionGrace),
+	}
+	if user.DeletionScheduledAt != nil {
+		data.DeletionScheduledAt = dateTimeLabel(*user.DeletionScheduledAt)
+	}
+
+	renderTemplate(ctx.Writer, deps.Templates.account, data)
+}
+
+func accountErrorMessage(err error, policy store.PasswordPolicy) string {
+	var lockout lockoutError
+	switch {
+	case errors.As(err, &lockout):
+		return lockout.Error()
+	case errors.Is(err, store.ErrInvalidCredentials):
+		return "Das aktuelle Passwort ist falsch."
+	case errors.Is(err, store.ErrEmailRequired):
+		return "Bitte eine E-Mail-Adresse angeben."
+	case errors.Is(err, store.ErrEmailUnchanged):
+		return "Das ist bereits deine aktuelle E-Mail-Adresse."
+	case errors.Is(err, store.ErrEmailExists):
+		return "Diese E-Mail ist bereits registriert."
+	}
+	if msg, ok := passwordErrorMessage(err, policy); ok {
+		return msg
+	}
+	return "Speichern fehlgeschlagen."
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAccountPasswordChecksAreThrottled(t *testing.T) {
+	server, storeInstance := newTestServer(t)
+	client := newTestClient(t)
+	login(t, client, server)
+	token := formToken(t, client, server, "/admin/account")
+
+	const newPassword = "Sporthalle-Montag-17"
+	form := url.Values{
+		"csrf_token":           {token},
+		"current_password":     {"falsch"},
+		"new_password":         {newPassword},
+		"new_password_confirm": {newPassword},
+	}
+	for i := 0; i < 3; i++ {
+		postForm(t, client, server, "/admin/account/password", form)
+	}
+
+	form.Set("current_password", testPassword)
+	body := postFormBody(t, client, server, "/admin/account/password", form)
+	if !strings.Contains(body, "Zu viele Versuche") {
+		t.Error("no lockout message after repeated wrong passwords")
+	}
+	if _, err := storeInstance.Authenticate(testEmail, testPassword); err != nil {
+		t.Fatalf("password changed while the account is locked: %v", err)
+	}
+
+	// The lockout is shared with the login form.
+	other := newTestClient(t)
+	body = postFormBody(t, other, server, "/login", url.Values{
+		"csrf_token": {formToken(t, other, server, "/login")},
+		"email":      {testEmail},
+		"password":   {testPassword},
+	})
+	if !strings.Contains(body, "Zu viele Versuche") {
+		t.Error("login is not locked after wrong passwords in the account settings")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/store"
+	"github.com/janmarkuslanger/graft/router"
+)
+
+const historyLimit = 200
+
+var clubFieldLabels = map[string]string{
+	"name":            "Name",
+	"slug":            "Adresse der Clubseite",
+	"description":     "Beschreibung",
+	"categories":      "Kategorien",
+	"contact_name":    "Ansprechperson",
+	"contact_role":    "Funktion",
+	"contact_email":   "Kontakt-E-Mail",
+	"contact_phone":   "Telefon",
+	"contact_website": "Website",
+	"address_line_1":  "Adresse",
+	"address_line_2":  "Adresszusatz",
+	"address_postal":  "PLZ",
+	"address_city":    "Ort",
+	"address_country": "Land",
+}
+
+var openingFieldLabels = map[string]string{
+	"opens_at":  "oeffnet",
+	"closes_at": "schliesst",
+	"note":      "Hinweis",
+}
+
+var courseFieldLabels = map[string]string{
+	"day_of_week": "Tag",
+	"start_time":  "Beginn",
+	"end_time":    "Ende",
+	"location":    "Ort",
+	"instructor":  "Leitung",
+	"level":       "Niveau",
+	"description": "Beschreibung",
+}
+
+func handleHistory(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+
+	club, hasClub := deps.Store.GetClubForUser(userID)
+	if !hasClub {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	data := historyData{
+		AppName:   appName(),
+		CSRFToken: csrfToken(ctx.Request),
+		Title:     "Verlauf",
+		ClubName:  club.Name,
+	}
+
+	entries, err := deps.Store.ClubHistory(club.ID, historyLimit)
+	if err != nil {
+		log.Printf("failed to load club history: %v", err)
+		data.Error = "Der Verlauf konnte nicht geladen werden."
+	}
+	for _, entry := range entries {
+		row := historyRow{
+			When:           dateTimeLabel(entry.CreatedAt),
+			Actor:          entry.ActorEmail,
+			ImpersonatedBy: entry.ImpersonatorEmail,
+			Entity:         auditEntityLabel(entry.Entity),
+		}
+		for _, change := range entry.Changes {
+			row.Changes = append(row.Changes, historyChange{
+				Field: auditFieldLabel(entry.Entity, change.Field),
+				Old:   auditValueLabel(entry.Entity, change.Field, change.Old),
+				New:   auditValueLabel(entry.Entity, change.Field, change.New),
+			})
+		}
+		data.Entries = append(data.Entries, row)
+	}
+
+	renderTemplate(ctx.Writer, deps.Templates.history, data)
+}
+
+func auditEntityLabel(entity string) string {
+	switch entity {
+	case store.AuditEntityClub:
+		return "Clubprofil"
+	case store.AuditEntityOpeningHours:
+		return "Oeffnungszeiten"
+	case store.AuditEntityCourses:
+		return "Kursplan"
+	case store.AuditEntityPublication:
+		return "Veroeffentlichung"
+	default:
+		return entity
+	}
+}
+
+func auditFieldLabel(entity, field string) string {
+	switch entity {
+	case store.AuditEntityClub:
+		if label, ok := clubFieldLabels[field]; ok {
+			return label
+		}
+	case store.AuditEntityOpeningHours:
+		day, column, ok := strings.Cut(field, ".")
+		if !ok {
+			break
+		}
+		dayNumber, _ := strconv.Atoi(day)
+		return weekdayLabel(dayNumber) + " " + labelOr(openingFieldLabels, column)
+	case store.AuditEntityCourses:
+		idx := strings.LastIndex(field, ".")
+		if idx < 0 {
+			break
+		}
+		return "Kurs \"" + field[:idx] + "\": " + labelOr(courseFieldLabels, field[idx+1:])
+	case store.AuditEntityPublication:
+		if field == "published_at" {
+			return "Veroeffentlicht"
+		}
+	}
+	return field
+}
+
+func auditValueLabel(entity, field, value string) string {
+	if entity == store.AuditEntityCourses && strings.HasSuffix(field, ".day_of_week") {
+		if day, err := strconv.Atoi(value); err == nil {
+			return weekdayLabel(day)
+		}
+	}
+	if entity == store.AuditEntityPublication && value != "" {
+		if at, err := time.Parse(time.RFC3339, value); err == nil {
+			return dateTimeLabel(at)
+		}
+	}
+	return value
+}
+
+func labelOr(labels map[string]string, key string) string {
+	if label, ok := labels[key]; ok {
+		return label
+	}
+	return key
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/janmarkuslanger/club-portal/internal/store"
+	"github.com/janmarkuslanger/graft/router"
+)
+
+var roleOptions = []roleOption{
+	{Value: store.RoleOwner, Label: "Inhaber"},
+	{Value: store.RoleEditor, Label: "Redaktion"},
+	{Value: store.RoleCourseManager, Label: "Kursverwaltung"},
+}
+
+func handleMembers(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+
+	info := ""
+	switch ctx.Request.URL.Query().Get("done") {
+	case "invite":
+		info = "Co-Admin hinzugefuegt."
+	case "role":
+		info = "Rolle geaendert."
+	case "remove":
+		info = "Co-Admin entfernt."
+	}
+
+	renderMembers(ctx, deps, userID, "", info)
+}
+
+func handleMemberInvite(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(ctx.Request.FormValue("email"))
+	role := ctx.Request.FormValue("role")
+	if _, err := deps.Store.AddMember(userID, email, role); err != nil {
+		renderMembers(ctx, deps, userID, memberErrorMessage(err), "")
+		return
+	}
+
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/members?done=invite", http.StatusSeeOther)
+}
+
+func handleMemberRole(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	memberID := ctx.Request.FormValue("user_id")
+	role := ctx.Request.FormValue("role")
+	if err := deps.Store.ChangeMemberRole(userID, memberID, role); err != nil {
+		renderMembers(ctx, deps, userID, memberErrorMessage(err), "")
+		return
+	}
+
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/members?done=role", http.StatusSeeOther)
+}
+
+func handleMemberRemove(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	memberID := ctx.Request.FormValue("user_id")
+	if err := deps.Store.RemoveMember(userID, memberID); err != nil {
+		renderMembers(ctx, deps, userID, memberErrorMessage(err), "")
+		return
+	}
+
+	if memberID == userID {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/members?done=remove", http.StatusSeeOther)
+}
+
+func renderMembers(ctx router.Context, deps adminDeps, userID, errMsg, info string) {
+	membership, ok := deps.Store.GetMembership(userID)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	club, _ := deps.Store.GetClubForUser(userID)
+	members, err := deps.Store.ListMembers(membership.ClubID)
+	if err != nil && errMsg == "" {
+		errMsg = "Co-Admins konnten nicht geladen werden."
+	}
+
+	data := membersData{
+		AppName:          appName(),
+		CSRFToken:        csrfToken(ctx.Request),
+		Title:            "Co-Admins",
+		Error:            errMsg,
+		Info:             info,
+		ClubName:         club.Name,
+		CanManageMembers: membership.CanManageMembers(),
+		Members:          make([]memberRow, 0, len(members)),
+		RoleOptions:      roleOptions,
+	}
+	for _, member := range members {
+		data.Members = append(data.Members, memberRow{
+			UserID:    member.UserID,
+			Email:     member.Email,
+			Role:      member.Role,
+			RoleLabel: roleLabel(member.Role),
+			IsSelf:    member.UserID == userID,
+		})
+	}
+
+	renderTemplate(ctx.Writer, deps.Templates.members, data)
+}
+
+func memberErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, store.ErrNotAllowed):
+		return "Nur Inhaber koennen Co-Admins verwalten."
+	case errors.Is(err, store.ErrUserNotFound):
+		return "Zu dieser E-Mail gibt es noch kein Konto. Bitte zuerst registrieren lassen."
+	case errors.Is(err, store.ErrAlreadyMember):
+		return "Dieses Konto verwaltet bereits einen Club."
+	case errors.Is(err, store.ErrMemberNotFound):
+		return "Co-Admin nicht gefunden."
+	case errors.Is(err, store.ErrLastOwner):
+		return "Der letzte Inhaber kann nicht entfernt oder herabgestuft werden."
+	case errors.Is(err, store.ErrInvalidRole):
+		return "Bitte eine gueltige Rolle waehlen."
+	default:
+		return "Aktion fehlgeschlagen."
+	}
+}
+
+func roleLabel(role string) string {
+	for _, option := range roleOptions {
+		if option.Value == role {
+			return option.Label
+		}
+	}
+	return role
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/store"
+	"github.com/janmarkuslanger/graft/router"
+)
+
+const buildRunLimit = 5
+
+func handlePreview(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+
+	club, hasClub := deps.Store.GetClubForUser(userID)
+	if !hasClub {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	renderPreview(ctx, deps, club)
+}
+
+// handleFormPreview renders the dashboard form as submitted, without saving
+// it. Fields the role cannot edit fall back to the stored draft.
+func handleFormPreview(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	club, _ := deps.Store.GetClubForUser(userID)
+	membership, isMember := deps.Store.GetMembership(userID)
+	if isMember && !membership.CanEditCourses() {
+		http.Error(ctx.Writer, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	if !isMember || membership.CanEditClub() {
+		club = store.PreviewClub(club, clubUpdateFromForm(ctx.Request))
+		club.OpeningHours = store.OpeningHoursFromInputs(club.ID, openingInputsFromForm(ctx.Request))
+	}
+	club.Courses = store.CoursesFromInputs(club.ID, courseInputsFromForm(ctx.Request))
+
+	renderPreview(ctx, deps, club)
+}
+
+func renderPreview(ctx router.Context, deps adminDeps, club store.Club) {
+	ctx.Writer.Header().Set("Cache-Control", "no-store")
+	ctx.Writer.Header().Set("X-Robots-Tag", "noindex")
+	ctx.Writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := deps.SiteRenderer.RenderClub(ctx.Writer, club); err != nil {
+		log.Printf("failed to render preview: %v", err)
+		http.Error(ctx.Writer, "preview failed", http.StatusInternalServerError)
+	}
+}
+
+func handlePublish(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+
+	club, hasClub := deps.Store.GetClubForUser(userID)
+	if !hasClub {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	if err := deps.Store.PublishClub(sessionActor(deps.Sessions, ctx.Request, userID), club.ID); err != nil {
+		if errors.Is(err, store.ErrNotAllowed) {
+			http.Error(ctx.Writer, "forbidden", http.StatusForbidden)
+			return
+		}
+		log.Printf("failed to publish club: %v", err)
+		http.Error(ctx.Writer, "publish failed", http.StatusInternalServerError)
+		return
+	}
+
+	if err := deps.Store.EnqueueClubBuildTask(club.ID, deps.BuildDebounce); err != nil {
+		log.Printf("failed to enqueue build task: %v", err)
+	}
+	http.Redirect(ctx.Writer, ctx.Request, "/admin?published=1", http.StatusSeeOther)
+}
+
+func applyPublicationState(data *dashboardData, deps adminDeps, clubID string) {
+	state, err := deps.Store.ClubPublicationState(clubID)
+	if err != nil {
+		log.Printf("failed to load publication state: %v", err)
+		return
+	}
+	data.HasDraftChanges = state.UnpublishedChange
+	if state.PublishedAt != nil {
+		data.PublishedAt = dateTimeLabel(*state.PublishedAt)
+		data.PublicPath = "/clubs/" + state.PublishedSlug + "/"
+	}
+}
+
+func applyBuildStatus(data *dashboardData, deps adminDeps, clubID string) {
+	status, err := deps.Store.ClubBuildStatus(clubID, buildRunLimit)
+	if err != nil {
+		log.Printf("failed to load build status: %v", err)
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case status.Running || (status.Scheduled && !status.NextRunAt.After(now)):
+		data.BuildState = "running"
+		data.BuildMessage = "Aenderungen werden gerade veroeffentlicht."
+	case status.Scheduled:
+		data.BuildState = "scheduled"
+		wait := status.NextRunAt.Sub(now)
+		if wait > time.Minute {
+			wait = wait.Round(time.Minute)
+		}
+		data.BuildMessage = "Aenderungen werden in " + durationLabel(wait) + " veroeffentlicht."
+	case status.LastFailure != nil:
+		data.BuildState = "failed"
+	case status.LastSuccess != nil && status.LastSuccess.FinishedAt != nil:
+		data.BuildState = "live"
+		data.BuildMessage = "Live seit " + dateTimeLabel(*status.LastSuccess.FinishedAt) + "."
+	}
+	// A failed build is retried, so it can be scheduled and failed at once.
+	// Runs can cover other clubs too, so their raw error stays on the
+	// platform console.
+	if status.LastFailure != nil {
+		data.BuildError = "Der letzte Build am " + dateTimeLabel(status.LastFailure.StartedAt) +
+			" ist fehlgeschlagen und wird automatisch wiederholt."
+	}
+
+	for _, run := range status.Recent {
+		data.BuildRuns = append(data.BuildRuns, buildRunRow{
+			When:     dateTimeLabel(run.StartedAt),
+			Status:   buildRunStatusLabel(run.Status),
+			Failed:   run.Status == store.BuildRunFailed,
+			Duration: runDurationLabel(run),
+		})
+	}
+}
+
+func runDurationLabel(run store.BuildRun) string {
+	if run.FinishedAt == nil {
+		return "-"
+	}
+	return (time.Duration(run.DurationMs) * time.Millisecond).Round(10 * time.Millisecond).String()
+}
+
+func buildRunStatusLabel(status string) string {
+	switch status {
+	case store.BuildRunRunning:
+		return "laeuft"
+	case store.BuildRunSucceeded:
+		return "erfolgreich"
+	case store.BuildRunFailed:
+		return "fehlgeschlagen"
+	default:
+		return status
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/janmarkuslanger/club-portal/internal/store"
+	"github.com/janmarkuslanger/graft/router"
+)
+
+func handleRevisions(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+
+	info := ""
+	if ctx.Request.URL.Query().Get("restored") == "1" {
+		info = "Version als Entwurf wiederhergestellt. Zum Uebernehmen auf der Website bitte veroeffentlichen."
+	}
+	selected, _ := strconv.ParseUint(ctx.Request.URL.Query().Get("id"), 10, 64)
+	renderRevisions(ctx, deps, userID, uint(selected), "", info)
+}
+
+func handleRevisionRestore(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	club, hasClub := deps.Store.GetClubForUser(userID)
+	membership, isMember := deps.Store.GetMembership(userID)
+	if !hasClub || !isMember || !membership.CanEditClub() {
+		http.Error(ctx.Writer, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	revisionID, err := strconv.ParseUint(ctx.Request.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(ctx.Writer, "invalid revision", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := deps.Store.RestoreClubRevision(sessionActor(deps.Sessions, ctx.Request, userID), club.ID, uint(revisionID), deps.RevisionRetention); err != nil {
+		msg := "Wiederherstellen fehlgeschlagen."
+		switch {
+		case errors.Is(err, store.ErrRevisionNotFound):
+			msg = "Diese Version gibt es nicht mehr."
+		case errors.Is(err, store.ErrNotAllowed):
+			msg = "Dafuer fehlen dir die Berechtigungen."
+		}
+		renderRevisions(ctx, deps, userID, uint(revisionID), msg, "")
+		return
+	}
+
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/revisions?restored=1", http.StatusSeeOther)
+}
+
+func renderRevisions(ctx router.Context, deps adminDeps, userID string, selected uint, errMsg, info string) {
+	club, hasClub := deps.Store.GetClubForUser(userID)
+	if !hasClub {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+		return
+	}
+	membership, isMember := deps.Store.GetMembership(userID)
+
+	data := revisionsData{
+		AppName:    appName(),
+		CSRFToken:  csrfToken(ctx.Request),
+		Title:      "Versionen",
+		Error:      errMsg,
+		Info:       info,
+		ClubName:   club.Name,
+		CanRestore: isMember && membership.CanEditClub(),
+	}
+
+	revisions, err := deps.Store.ClubRevisions(club.ID)
+	if err != nil {
+		log.Printf("failed to load club revisions: %v", err)
+		data.Error = "Die Versionen konnten nicht geladen werden."
+	}
+	for i, revision := range revisions {
+		row := revisionRow{
+			ID:       revision.ID,
+			When:     dateTimeLabel(revision.CreatedAt),
+			Actor:    revision.ActorEmail,
+			Current:  i == 0,
+			Selected: revision.ID == selected,
+		}
+		if row.Selected {
+			data.Selected = &row
+		}
+		data.Revisions = append(data.Revisions, row)
+	}
+
+	if data.Selected != nil {
+		changes, err := deps.Store.CompareClubRevision(club.ID, selected)
+		if err != nil {
+			log.Printf("failed to compare club revision: %v", err)
+			data.Error = "Die Version konnte nicht verglichen werden."
+		}
+		for _, change := range changes {
+			data.Changes = append(data.Changes, revisionChangeRow{
+				Entity:   auditEntityLabel(change.Entity),
+				Field:    auditFieldLabel(change.Entity, change.Field),
+				Revision: auditValueLabel(change.Entity, change.Field, change.Old),
+				Current:  auditValueLabel(change.Entity, change.Field, change.New),
+			})
+		}
+	}
+
+	renderTemplate(ctx.Writer, deps.Templates.revisions, data)
+}
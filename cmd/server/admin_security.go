@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+	"github.com/janmarkuslanger/graft/router"
+)
+
+func handleSecurity(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+
+	info := ""
+	switch ctx.Request.URL.Query().Get("done") {
+	case "disabled":
+		info = "Zwei-Faktor-Anmeldung deaktiviert."
+	}
+	renderSecurity(ctx, deps, userID, "", info, nil)
+}
+
+func handleTOTPStart(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+
+	if err := deps.Store.SetPendingTOTPSecret(userID, auth.NewTOTPSecret()); err != nil {
+		renderSecurity(ctx, deps, userID, "Einrichtung fehlgeschlagen.", "", nil)
+		return
+	}
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/security", http.StatusSeeOther)
+}
+
+func handleTOTPConfirm(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := deps.Store.GetUser(userID)
+	if !ok || user.TOTPSecret == "" || user.TOTPEnabled() {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin/security", http.StatusSeeOther)
+		return
+	}
+
+	step, valid := auth.VerifyTOTP(user.TOTPSecret, ctx.Request.FormValue("code"), time.Now())
+	if !valid {
+		renderSecurity(ctx, deps, userID, "Der Code ist ungueltig. Bitte pruefe die Uhrzeit deines Geraets.", "", nil)
+		return
+	}
+
+	codes, err := deps.Store.EnableTOTP(userID, step)
+	if err != nil {
+		renderSecurity(ctx, deps, userID, "Aktivierung fehlgeschlagen.", "", nil)
+		return
+	}
+
+	renderSecurity(ctx, deps, userID, "", "Zwei-Faktor-Anmeldung aktiviert. Bewahre die Wiederherstellungscodes sicher auf.", codes)
+}
+
+func handleTOTPDisable(ctx router.Context, deps adminDeps) {
+	userID, ok := verifiedUserID(ctx, deps)
+	if !ok {
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := deps.Store.GetUser(userID)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	if !user.TOTPEnabled() {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin/security", http.StatusSeeOther)
+		return
+	}
+
+	err := confirmPassword(deps, user.Email, func() error {
+		_, err := deps.Store.Authenticate(user.Email, ctx.Request.FormValue("password"))
+		return err
+	})
+	if err != nil {
+		msg := "Deaktivierung fehlgeschlagen."
+		var lockout lockoutError
+		switch {
+		case errors.As(err, &lockout):
+			msg = lockout.Error()
+		case errors.Is(err, store.ErrInvalidCredentials):
+			msg = "Das Passwort ist falsch."
+		}
+		renderSecurity(ctx, deps, userID, msg, "", nil)
+		return
+	}
+
+	// The code is throttled like the second step of the login.
+	now := time.Now()
+	limitKey := "totp:" + userID
+	if wait, ok := deps.AccountLimiter.Check(limitKey, now); !ok {
+		renderSecurity(ctx, deps, userID, lockoutMessage(wait), "", nil)
+		return
+	}
+	if err := checkSecondFactor(deps.Store, user, ctx.Request.FormValue("code"), now); err != nil {
+		if deps.AccountLimiter.Fail(limitKey, now) {
+			log.Printf("two-factor confirmation locked for account %q after repeated failures", user.Email)
+		}
+		renderSecurity(ctx, deps, userID, "Der Code ist ungueltig. Bitte versuche es erneut.", "", nil)
+		return
+	}
+	deps.AccountLimiter.Reset(limitKey)
+
+	if err := deps.Store.DisableTOTP(userID); err != nil {
+		renderSecurity(ctx, deps, userID, "Deaktivierung fehlgeschlagen.", "", nil)
+		return
+	}
+	http.Redirect(ctx.Writer, ctx.Request, "/admin/security?done=disabled", http.StatusSeeOther)
+}
+
+func renderSecurity(ctx router.Context, deps adminDeps, userID, errMsg, info string, recoveryCodes []string) {
+	user, ok := deps.Store.GetUser(userID)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := securityData{
+		AppName:       appName(),
+		CSRFToken:     csrfToken(ctx.Request),
+		Title:         "Sicherheit",
+		Error:         errMsg,
+		Info:          info,
+		Email:         user.Email,
+		TOTPEnabled:   user.TOTPEnabled(),
+		TOTPPending:   !user.TOTPEnabled() && user.TOTPSecret != "",
+		RecoveryCodes: recoveryCodes,
+	}
+	if data.TOTPPending {
+		data.Secret = user.TOTPSecret
+		data.ProvisioningURI = template.URL(auth.TOTPProvisioningURI(appName(), user.Email, user.TOTPSecret))
+	}
+	if data.TOTPEnabled {
+		data.RemainingRecoveryCodes = deps.Store.RemainingRecoveryCodes(userID)
+	}
+
+	renderTemplate(ctx.Writer, deps.Templates.security, data)
+}
+
+// lockoutError is returned instead of running a throttled check.
+type lockoutError struct {
+	wait time.Duration
+}
+
+func (e lockoutError) Error() string {
+	return lockoutMessage(e.wait)
+}
+
+// confirmPassword runs check, which verifies the current password of a
+// logged-in user, under the account limit of the login form, so a hijacked
+// session cannot be used to guess the password.
+func confirmPassword(deps adminDeps, email string, check func() error) error {
+	now := time.Now()
+	key := accountLimitKey(email)
+	if wait, ok := deps.AccountLimiter.Check(key, now); !ok {
+		return lockoutError{wait: wait}
+	}
+
+	err := check()
+	switch {
+	case err == nil:
+		deps.AccountLimiter.Reset(key)
+	case errors.Is(err, store.ErrInvalidCredentials):
+		if deps.AccountLimiter.Fail(key, now) {
+			log.Printf("password confirmation locked for account %q after repeated failures", email)
+		}
+	}
+	return err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+// enableTOTP turns on two-factor login for the test user and logs client in
+// with the first recovery code. The remaining codes are returned.
+func enableTOTP(t *testing.T, client *http.Client, server *httptest.Server, storeInstance *store.Store) (store.User, []string) {
+	t.Helper()
+
+	user, err := storeInstance.Authenticate(testEmail, testPassword)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if err := storeInstance.SetPendingTOTPSecret(user.ID, auth.NewTOTPSecret()); err != nil {
+		t.Fatalf("SetPendingTOTPSecret: %v", err)
+	}
+	codes, err := storeInstance.EnableTOTP(user.ID, 0)
+	if err != nil {
+		t.Fatalf("EnableTOTP: %v", err)
+	}
+
+	login(t, client, server)
+	token := formToken(t, client, server, "/login/2fa")
+	if status := postForm(t, client, server, "/login/2fa", url.Values{"csrf_token": {token}, "code": {codes[0]}}); status != http.StatusSeeOther {
+		t.Fatalf("two-factor login: status %d, want 303", status)
+	}
+	return user, codes[1:]
+}
+
+func totpEnabled(t *testing.T, storeInstance *store.Store, userID string) bool {
+	t.Helper()
+
+	user, ok := storeInstance.GetUser(userID)
+	if !ok {
+		t.Fatal("test user missing")
+	}
+	return user.TOTPEnabled()
+}
+
+func postFormBody(t *testing.T, client *http.Client, server *httptest.Server, path string, form url.Values) string {
+	t.Helper()
+
+	resp, err := client.PostForm(server.URL+path, form)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestTOTPDisableNeedsPasswordAndCode(t *testing.T) {
+	server, storeInstance := newTestServer(t)
+	client := newTestClient(t)
+	user, codes := enableTOTP(t, client, server, storeInstance)
+	token := formToken(t, client, server, "/admin/security")
+
+	postForm(t, client, server, "/admin/security/totp/disable", url.Values{"csrf_token": {token}, "password": {testPassword}})
+	if !totpEnabled(t, storeInstance, user.ID) {
+		t.Fatal("two-factor login disabled without a code")
+	}
+	postForm(t, client, server, "/admin/security/totp/disable", url.Values{"csrf_token": {token}, "password": {testPassword}, "code": {"000000"}})
+	if !totpEnabled(t, storeInstance, user.ID) {
+		t.Fatal("two-factor login disabled with a wrong code")
+	}
+
+	status := postForm(t, client, server, "/admin/security/totp/disable", url.Values{"csrf_token": {token}, "password": {testPassword}, "code": {codes[0]}})
+	if status != http.StatusSeeOther || totpEnabled(t, storeInstance, user.ID) {
+		t.Fatalf("disable with password and code: status %d, still enabled %v", status, totpEnabled(t, storeInstance, user.ID))
+	}
+}
+
+func TestTOTPDisableThrottlesPasswordGuesses(t *testing.T) {
+	server, storeInstance := newTestServer(t)
+	client := newTestClient(t)
+	user, codes := enableTOTP(t, client, server, storeInstance)
+	token := formToken(t, client, server, "/admin/security")
+
+	for i := 0; i < 3; i++ {
+		postForm(t, client, server, "/admin/security/totp/disable", url.Values{"csrf_token": {token}, "password": {"falsch"}, "code": {codes[0]}})
+	}
+	body := postFormBody(t, client, server, "/admin/security/totp/disable", url.Values{"csrf_token": {token}, "password": {testPassword}, "code": {codes[0]}})
+	if !strings.Contains(body, "Zu viele Versuche") {
+		t.Error("no lockout message after repeated wrong passwords")
+	}
+	if !totpEnabled(t, storeInstance, user.ID) {
+		t.Fatal("two-factor login disabled while the account is locked")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/janmarkuslanger/graft/graft"
+	"github.com/janmarkuslanger/graft/router"
+)
+
+// serverApp wraps graft so the routes can be served from our own
+// http.Server: graft's Run starts the modules and then blocks in
+// http.ListenAndServe, which cannot be drained on shutdown.
+type serverApp struct {
+	graft *graft.Graft
+	mux   *http.ServeMux
+	hooks []graft.HookModule
+}
+
+func newServerApp() *serverApp {
+	app := &serverApp{graft: graft.New()}
+	app.graft.UseModule(muxModule{app: app})
+	return app
+}
+
+func (a *serverApp) UseModule(m graft.Module) {
+	a.graft.UseModule(m)
+	if hooks, ok := m.(graft.HookModule); ok {
+		a.hooks = append(a.hooks, hooks)
+	}
+}
+
+// Start runs the OnStart hooks of all modules in the order they were added,
+// as graft's Run would, and returns the handler serving their routes.
+func (a *serverApp) Start() http.Handler {
+	for _, hooks := range a.hooks {
+		hooks.OnStart()
+	}
+	return a.mux
+}
+
+// muxModule picks up the mux that graft registers all routes on.
+type muxModule struct {
+	app *serverApp
+}
+
+func (m muxModule) BuildRoutes(r router.Router) {
+	m.app.mux = r.Mux
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/graft/router"
+)
+
+const (
+	csrfCookieName = "club_portal_csrf"
+	csrfFieldName  = "csrf_token"
+)
+
+type csrfContextKey struct{}
+
+// requireCSRF issues a token bound to the session cookie (or, before login,
+// to a random pre-session cookie) and rejects state-changing requests whose
+// form token does not match.
+func requireCSRF(signer *auth.Signer, forbidden *template.Template, secure bool) router.Middleware {
+	return func(ctx router.Context, next router.HandlerFunc) {
+		seed := csrfSeed(ctx.Request)
+		if seed == "" {
+			seed = "anon:" + newCSRFNonce()
+			http.SetCookie(ctx.Writer, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    seed,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+				Secure:   secure,
+			})
+		}
+
+		token := signer.MAC("csrf|" + seed)
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), csrfContextKey{}, token))
+
+		if ctx.Request.Method != http.MethodGet && ctx.Request.Method != http.MethodHead {
+			if err := ctx.Request.ParseForm(); err != nil {
+				http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+				return
+			}
+			submitted := ctx.Request.PostFormValue(csrfFieldName)
+			if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+				log.Printf("csrf token mismatch for %s %s", ctx.Request.Method, ctx.Request.URL.Path)
+				data := forbiddenData{
+					AppName: appName(),
+					Title:   "Anfrage abgelehnt",
+					Message: "Das Formular ist abgelaufen oder stammt nicht von dieser Seite. Bitte lade die Seite neu und versuche es erneut.",
+				}
+				renderTemplateStatus(ctx.Writer, http.StatusForbidden, forbidden, data)
+				return
+			}
+		}
+
+		next(ctx)
+	}
+}
+
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey{}).(string)
+	return token
+}
+
+func csrfSeed(r *http.Request) string {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+		return "session:" + cookie.Value
+	}
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	return ""
+}
+
+func newCSRFNonce() string {
+	var buf [16]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf[:])
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/club-portal/internal/mail"
+	"github.com/janmarkuslanger/club-portal/internal/site"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+const (
+	testEmail    = "vorstand@example.org"
+	testPassword = "Turnhalle-Sonntag-42"
+)
+
+var csrfInputPattern = regexp.MustCompile(`name="csrf_token" value="([^"]*)"`)
+
+func newTestServer(t *testing.T) (*httptest.Server, *store.Store) {
+	t.Helper()
+	// The templates are loaded relative to the repository root, as in main.
+	t.Chdir(filepath.Join("..", ".."))
+
+	storeInstance, err := store.NewStore(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { storeInstance.Close() })
+
+	user, err := storeInstance.CreateUser(testEmail, testPassword)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := storeInstance.MarkEmailVerified(user.ID, user.Email); err != nil {
+		t.Fatalf("MarkEmailVerified: %v", err)
+	}
+
+	tmpls, err := loadTemplates(filepath.Join("templates", "admin"))
+	if err != nil {
+		t.Fatalf("loadTemplates: %v", err)
+	}
+	siteRenderer, err := site.NewRenderer(filepath.Join("templates", "site"))
+	if err != nil {
+		t.Fatalf("NewRenderer: %v", err)
+	}
+	sessions := auth.NewManagerWithStore(storeSessions{store: storeInstance}, time.Hour)
+	signer := auth.NewSigner([]byte("test-signing-key"))
+	mailer := mail.FileMailer{Dir: t.TempDir()}
+	verifier := emailVerifier{Signer: signer, Mailer: mailer, BaseURL: "http://example.test", TTL: time.Hour}
+	accountLimiter := auth.NewLimiter(auth.LimiterConfig{})
+
+	app := newServerApp()
+	app.UseModule(publicModule(publicDeps{
+		Sessions:  sessions,
+		Signer:    signer,
+		Templates: tmpls,
+		Store:     storeInstance,
+	}))
+	app.UseModule(authModule(authDeps{
+		Store:            storeInstance,
+		Sessions:         sessions,
+		Signer:           signer,
+		Templates:        tmpls,
+		Mailer:           mailer,
+		Verifier:         verifier,
+		BaseURL:          "http://example.test",
+		PasswordResetTTL: time.Hour,
+		AccountLimiter:   accountLimiter,
+		IPLimiter:        auth.NewLimiter(auth.LimiterConfig{}),
+	}))
+	app.UseModule(adminModule(adminDeps{
+		Store:         storeInstance,
+		Sessions:      sessions,
+		Signer:        signer,
+		Templates:     tmpls,
+		Mailer:        mailer,
+		Verifier:      verifier,
+		SiteRenderer:  siteRenderer,
+		DeletionGrace: time.Hour,
+
+		AccountLimiter: accountLimiter,
+	}))
+
+	server := httptest.NewServer(app.Start())
+	t.Cleanup(server.Close)
+	return server, storeInstance
+}
+
+// newTestClient keeps cookies like a browser but does not follow redirects,
+// so the status of the form submission itself can be checked.
+func newTestClient(t *testing.T) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{
+		Jar: jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// formToken loads page and returns the CSRF token rendered into its form.
+func formToken(t *testing.T, client *http.Client, server *httptest.Server, page string) string {
+	t.Helper()
+
+	resp, err := client.Get(server.URL + page)
+	if err != nil {
+		t.Fatalf("GET %s: %v", page, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := csrfInputPattern.FindSubmatch(body)
+	if match == nil {
+		t.Fatalf("GET %s: no csrf token in page (status %d)", page, resp.StatusCode)
+	}
+	return string(match[1])
+}
+
+func postForm(t *testing.T, client *http.Client, server *httptest.Server, path string, form url.Values) int {
+	t.Helper()
+
+	resp, err := client.PostForm(server.URL+path, form)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func login(t *testing.T, client *http.Client, server *httptest.Server) {
+	t.Helper()
+
+	token := formToken(t, client, server, "/login")
+	status := postForm(t, client, server, "/login", url.Values{
+		"csrf_token": {token},
+		"email":      {testEmail},
+		"password":   {testPassword},
+	})
+	if status != http.StatusSeeOther {
+		t.Fatalf("login: status %d, want %d", status, http.StatusSeeOther)
+	}
+}
+
+func withToken(form url.Values, token string) url.Values {
+	out := url.Values{}
+	for key, values := range form {
+		out[key] = values
+	}
+	if token != "" {
+		out.Set("csrf_token", token)
+	}
+	return out
+}
+
+func TestCSRFRejectsAnonymousFormsWithoutValidToken(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	forms := map[string]url.Values{
+		"/login":    {"email": {testEmail}, "password": {testPassword}},
+		"/register": {"email": {"neu@example.org"}, "password": {testPassword}, "password_confirm": {testPassword}},
+	}
+	for path, form := range forms {
+		client := newTestClient(t)
+		formToken(t, client, server, path)
+		foreign := formToken(t, newTestClient(t), server, path)
+
+		if status := postForm(t, client, server, path, form); status != http.StatusForbidden {
+			t.Errorf("POST %s without token: status %d, want 403", path, status)
+		}
+		if status := postForm(t, client, server, path, withToken(form, foreign)); status != http.StatusForbidden {
+			t.Errorf("POST %s with another visitor's token: status %d, want 403", path, status)
+		}
+	}
+}
+
+func TestCSRFAcceptsRenderedTokenOnAnonymousForms(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	client := newTestClient(t)
+	token := formToken(t, client, server, "/register")
+	status := postForm(t, client, server, "/register", url.Values{
+		"csrf_token":       {token},
+		"email":            {"neu@example.org"},
+		"password":         {testPassword},
+		"password_confirm": {testPassword},
+	})
+	if status != http.StatusSeeOther {
+		t.Fatalf("POST /register with rendered token: status %d, want 303", status)
+	}
+
+	login(t, newTestClient(t), server)
+}
+
+func TestCSRFRejectsSessionFormsWithoutValidToken(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	client := newTestClient(t)
+	login(t, client, server)
+	other := newTestClient(t)
+	login(t, other, server)
+	foreign := formToken(t, other, server, "/admin")
+
+	forms := map[string]url.Values{
+		"/admin/club": {"name": {"TSV Beispiel"}, "description": {"Breitensport"}},
+		"/logout":     {},
+	}
+	for path, form := range forms {
+		if status := postForm(t, client, server, path, form); status != http.StatusForbidden {
+			t.Errorf("POST %s without token: status %d, want 403", path, status)
+		}
+		if status := postForm(t, client, server, path, withToken(form, foreign)); status != http.StatusForbidden {
+			t.Errorf("POST %s with another session's token: status %d, want 403", path, status)
+		}
+	}
+
+	token := formToken(t, client, server, "/admin")
+	if status := postForm(t, client, server, "/admin/club", withToken(forms["/admin/club"], token)); status != http.StatusSeeOther {
+		t.Errorf("POST /admin/club with rendered token: status %d, want 303", status)
+	}
+	if status := postForm(t, client, server, "/logout", withToken(forms["/logout"], token)); status != http.StatusSeeOther {
+		t.Errorf("POST /logout with rendered token: status %d, want 303", status)
+	}
+}
+
+// The pre-login token is bound to the anonymous cookie; once the session
+// cookie is set, only tokens rendered for the session are accepted.
+func TestCSRFTokenMovesFromAnonymousCookieToSession(t *testing.T) {
+	server, _ := newTestServer(t)
+
+	client := newTestClient(t)
+	anonToken := formToken(t, client, server, "/login")
+	status := postForm(t, client, server, "/login", url.Values{
+		"csrf_token": {anonToken},
+		"email":      {testEmail},
+		"password":   {testPassword},
+	})
+	if status != http.StatusSeeOther {
+		t.Fatalf("login: status %d, want 303", status)
+	}
+
+	serverURL, _ := url.Parse(server.URL)
+	var hasSession bool
+	for _, cookie := range client.Jar.Cookies(serverURL) {
+		if cookie.Name == sessionCookieName && cookie.Value != "" {
+			hasSession = true
+		}
+	}
+	if !hasSession {
+		t.Fatal("login did not set the session cookie")
+	}
+
+	sessionToken := formToken(t, client, server, "/admin")
+	if sessionToken == anonToken {
+		t.Fatal("session token equals the anonymous token")
+	}
+	if status := postForm(t, client, server, "/logout", url.Values{"csrf_token": {anonToken}}); status != http.StatusForbidden {
+		t.Errorf("POST /logout with pre-login token: status %d, want 403", status)
+	}
+	if status := postForm(t, client, server, "/logout", url.Values{"csrf_token": {sessionToken}}); status != http.StatusSeeOther {
+		t.Errorf("POST /logout with session token: status %d, want 303", status)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+// startDeletionSweeper purges due accounts until ctx is done. The returned
+// channel is closed once a purge that was running at that point finished.
+func startDeletionSweeper(ctx context.Context, storeInstance *store.Store, interval, buildDebounce time.Duration) <-chan struct{} {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purgeDeletedAccounts(storeInstance, buildDebounce)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return done
+}
+
+func purgeDeletedAccounts(storeInstance *store.Store, buildDebounce time.Duration) {
+	purged, err := storeInstance.PurgeScheduledDeletions(time.Now())
+	if err != nil {
+		log.Printf("account purge failed: %v", err)
+	}
+	if purged == 0 {
+		return
+	}
+
+	log.Printf("account purge removed %d accounts", purged)
+	// The rebuild drops the static pages of deleted clubs.
+	if err := storeInstance.EnqueueBuildTask(buildDebounce); err != nil {
+		log.Printf("failed to enqueue build task: %v", err)
+	}
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/janmarkuslanger/club-portal/internal/auth"
 	"github.com/janmarkuslanger/club-portal/internal/i18n"
 )
 
-const sessionCookieName = "club_portal_session"
+const (
+	sessionCookieName = "club_portal_session"
+	preAuthCookieName = "club_portal_preauth"
+)
 
 func sessionUserID(sessions *auth.Manager, r *http.Request) (string, bool) {
 	cookie, err := r.Cookie(sessionCookieName)
@@ -42,6 +48,29 @@ func clearSessionCookie(w http.ResponseWriter, secure bool) {
 	})
 }
 
+func setPreAuthCookie(w http.ResponseWriter, token string, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     preAuthCookieName,
+		Value:    token,
+		Path:     "/login",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   secure,
+	})
+}
+
+func clearPreAuthCookie(w http.ResponseWriter, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     preAuthCookieName,
+		Value:    "",
+		Path:     "/login",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   secure,
+		MaxAge:   -1,
+	})
+}
+
 func renderTemplate(w http.ResponseWriter, tmpl *template.Template, data any) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	if err := tmpl.Execute(w, data); err != nil {
@@ -49,6 +78,30 @@ func renderTemplate(w http.ResponseWriter, tmpl *template.Template, data any) {
 	}
 }
 
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := strings.TrimSpace(first); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func renderTemplateStatus(w http.ResponseWriter, status int, tmpl *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, "template error", http.StatusInternalServerError)
+	}
+}
+
 func errorMessage(msg string) string {
 	msg = strings.TrimSpace(msg)
 	if msg == "" {
@@ -57,6 +110,29 @@ func errorMessage(msg string) string {
 	return msg
 }
 
+func durationLabel(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour && d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%d Tage", int(d/(24*time.Hour)))
+	case d == time.Hour:
+		return "1 Stunde"
+	case d > time.Hour && d%time.Hour == 0:
+		return fmt.Sprintf("%d Stunden", int(d/time.Hour))
+	case d <= time.Second:
+		return "1 Sekunde"
+	case d < time.Minute:
+		return fmt.Sprintf("%d Sekunden", int((d+time.Second-1)/time.Second))
+	case d == time.Minute:
+		return "1 Minute"
+	default:
+		return fmt.Sprintf("%d Minuten", int(d.Round(time.Minute)/time.Minute))
+	}
+}
+
+func dateTimeLabel(t time.Time) string {
+	return t.Local().Format("02.01.2006 um 15:04 Uhr")
+}
+
 func appName() string {
 	return i18n.AppName()
 }
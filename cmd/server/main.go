@@ -1,46 +1,132 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/club-portal/internal/buildnotify"
+	"github.com/janmarkuslanger/club-portal/internal/mail"
+	"github.com/janmarkuslanger/club-portal/internal/site"
 	"github.com/janmarkuslanger/club-portal/internal/store"
-	"github.com/janmarkuslanger/graft/graft"
 )
 
 const (
 	defaultDataPath  = "data/store.db"
 	defaultOutputDir = "public"
+	defaultBaseURL   = "http://localhost:8080"
+	defaultMailDir   = "data/mail"
 )
 
 func main() {
 	dataPath := envOrDefault("DATA_PATH", defaultDataPath)
 	outputDir := envOrDefault("OUTPUT_DIR", defaultOutputDir)
+	siteTemplates := envOrDefault("TEMPLATE_DIR", filepath.Join("templates", "site"))
 
 	storeInstance, err := store.NewStore(dataPath)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sessions := auth.NewManager(envDuration("SESSION_TTL", 24*time.Hour))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	notifySocket := envOrDefault("BUILD_NOTIFY_SOCKET", buildnotify.SocketPath(dataPath))
+	buildWorker, err := newEmbeddedWorker(envOrDefault("WORKER_MODE", workerModeStandalone), storeInstance, dataPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// A failed notification only means no worker is listening right now; the
+	// worker still finds the task on its next poll. An embedded worker may be
+	// on standby, so the socket is notified in any case.
+	storeInstance.OnBuildEnqueued(func() {
+		if buildWorker != nil {
+			buildWorker.Wake()
+		}
+		_ = buildnotify.Send(notifySocket)
+	})
+
+	defaultPolicy := store.DefaultPasswordPolicy()
+	storeInstance.SetPasswordPolicy(store.PasswordPolicy{
+		MinLength:     envInt("PASSWORD_MIN_LENGTH", defaultPolicy.MinLength),
+		MaxLength:     envInt("PASSWORD_MAX_LENGTH", defaultPolicy.MaxLength),
+		RequireUpper:  envBool("PASSWORD_REQUIRE_UPPER", defaultPolicy.RequireUpper),
+		RequireLower:  envBool("PASSWORD_REQUIRE_LOWER", defaultPolicy.RequireLower),
+		RequireDigit:  envBool("PASSWORD_REQUIRE_DIGIT", defaultPolicy.RequireDigit),
+		RequireSymbol: envBool("PASSWORD_REQUIRE_SYMBOL", defaultPolicy.RequireSymbol),
+		RejectEmail:   envBool("PASSWORD_REJECT_EMAIL", defaultPolicy.RejectEmail),
+		RejectCommon:  envBool("PASSWORD_REJECT_COMMON", defaultPolicy.RejectCommon),
+	})
+
+	if raw := envOrDefault("PLATFORM_ADMINS", ""); raw != "" {
+		missing, err := storeInstance.SyncPlatformAdmins(strings.Split(raw, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, email := range missing {
+			log.Printf("platform admin %s has no account yet; register it and restart", email)
+		}
+	}
+
+	sessions := auth.NewManagerWithStore(
+		storeSessions{store: storeInstance},
+		envDuration("SESSION_TTL", 24*time.Hour),
+	)
+	sessions.StartSweeper(envDuration("SESSION_SWEEP_INTERVAL", 10*time.Minute))
+	defer sessions.Close()
 	cookieSecure := envBool("COOKIE_SECURE", false)
 
 	tmpls, err := loadTemplates(filepath.Join("templates", "admin"))
 	if err != nil {
 		log.Fatal(err)
 	}
+	siteRenderer, err := site.NewRenderer(siteTemplates)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	buildDebounce := envDuration("BUILD_DEBOUNCE", 2*time.Minute)
+	sweeperDone := startDeletionSweeper(ctx, storeInstance, envDuration("ACCOUNT_PURGE_INTERVAL", time.Hour), buildDebounce)
+	baseURL := strings.TrimRight(envOrDefault("BASE_URL", defaultBaseURL), "/")
+	mailer := newMailer()
 
-	app := graft.New()
-	app.UseModule(seedModule{
-		Store: storeInstance,
+	signingKey := []byte(envOrDefault("APP_SECRET", ""))
+	if len(signingKey) == 0 {
+		signingKey, err = storeInstance.EnsureSecret("signing_key")
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	signer := auth.NewSigner(signingKey)
+	verifier := emailVerifier{
+		Signer:  signer,
+		Mailer:  mailer,
+		BaseURL: baseURL,
+		TTL:     envDuration("VERIFICATION_TTL", 72*time.Hour),
+	}
+
+	accountLimiter := auth.NewLimiter(auth.LimiterConfig{
+		MaxAttempts: envInt("LOGIN_MAX_ATTEMPTS", 5),
+		BaseDelay:   envDuration("LOGIN_BACKOFF_BASE", time.Second),
+		MaxDelay:    envDuration("LOGIN_BACKOFF_MAX", time.Minute),
+		Lockout:     envDuration("LOGIN_LOCKOUT", 15*time.Minute),
 	})
+
+	app := newServerApp()
+	if envBool("SEED_EXAMPLE_CLUB", false) {
+		app.UseModule(seedModule{
+			Store: storeInstance,
+		})
+	}
 	app.UseModule(staticModule{
 		AdminAssetsDir: filepath.Join("static", "admin"),
 		SiteAssetsDir:  filepath.Join(outputDir, "assets"),
@@ -48,26 +134,94 @@ func main() {
 	})
 
 	app.UseModule(publicModule(publicDeps{
-		Sessions:  sessions,
-		Templates: tmpls,
-		Store:     storeInstance,
-	}))
-	app.UseModule(authModule(authDeps{
-		Store:        storeInstance,
 		Sessions:     sessions,
+		Signer:       signer,
 		Templates:    tmpls,
+		Store:        storeInstance,
+		CookieSecure: cookieSecure,
+	}))
+	app.UseModule(authModule(authDeps{
+		Store:            storeInstance,
+		Sessions:         sessions,
+		Signer:           signer,
+		Templates:        tmpls,
+		Mailer:           mailer,
+		Verifier:         verifier,
+		BaseURL:          baseURL,
+		PasswordResetTTL: envDuration("PASSWORD_RESET_TTL", time.Hour),
+		AccountLimiter:   accountLimiter,
+		IPLimiter: auth.NewLimiter(auth.LimiterConfig{
+			MaxAttempts: envInt("LOGIN_MAX_ATTEMPTS_PER_IP", 20),
+			BaseDelay:   envDuration("LOGIN_BACKOFF_BASE", time.Second),
+			MaxDelay:    envDuration("LOGIN_BACKOFF_MAX", time.Minute),
+			Lockout:     envDuration("LOGIN_LOCKOUT", 15*time.Minute),
+		}),
+		TrustProxy:   envBool("TRUST_PROXY_HEADERS", false),
 		CookieSecure: cookieSecure,
 	}))
 	app.UseModule(adminModule(adminDeps{
 		Store:         storeInstance,
 		Sessions:      sessions,
+		Signer:        signer,
 		Templates:     tmpls,
+		Mailer:        mailer,
+		Verifier:      verifier,
+		SiteRenderer:  siteRenderer,
 		BuildDebounce: buildDebounce,
+		DeletionGrace: envDuration("ACCOUNT_DELETION_GRACE", 72*time.Hour),
 		CookieSecure:  cookieSecure,
+
+		RevisionRetention: envInt("CLUB_REVISION_RETENTION", 50),
+
+		AccountLimiter: accountLimiter,
+	}))
+
+	app.UseModule(platformModule(platformDeps{
+		Store:        storeInstance,
+		Sessions:     sessions,
+		Signer:       signer,
+		Templates:    tmpls,
+		CookieSecure: cookieSecure,
 	}))
 
+	server := &http.Server{Addr: ":8080", Handler: app.Start()}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
 	log.Printf("%s server running on :8080", appName())
-	app.Run()
+	workerDone := startWorker(ctx, buildWorker)
+
+	<-ctx.Done()
+	log.Println("shutting down, finishing open requests")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", 30*time.Second))
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+
+	<-workerDone
+	<-sweeperDone
+	sessions.Close()
+	if err := storeInstance.Close(); err != nil {
+		log.Printf("closing store failed: %v", err)
+	}
+}
+
+func newMailer() mail.Mailer {
+	host := envOrDefault("SMTP_HOST", "")
+	if host == "" {
+		return mail.FileMailer{Dir: envOrDefault("MAIL_DIR", defaultMailDir)}
+	}
+
+	return mail.SMTPMailer{
+		Host:     host,
+		Port:     envInt("SMTP_PORT", 587),
+		Username: envOrDefault("SMTP_USERNAME", ""),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     envOrDefault("MAIL_FROM", "noreply@club-portal.test"),
+	}
 }
 
 func envOrDefault(key, fallback string) string {
@@ -90,6 +244,18 @@ func envDuration(key string, fallback time.Duration) time.Duration {
 	return parsed
 }
 
+func envInt(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
 func envBool(key string, fallback bool) bool {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
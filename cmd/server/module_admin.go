@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/club-portal/internal/mail"
+	"github.com/janmarkuslanger/club-portal/internal/site"
 	"github.com/janmarkuslanger/club-portal/internal/store"
 	"github.com/janmarkuslanger/graft/module"
 	"github.com/janmarkuslanger/graft/router"
@@ -19,20 +21,56 @@ const courseExtraRows = 3
 type adminDeps struct {
 	Store         *store.Store
 	Sessions      *auth.Manager
+	Signer        *auth.Signer
 	Templates     templates
+	Mailer        mail.Mailer
+	Verifier      emailVerifier
+	SiteRenderer  *site.Renderer
 	BuildDebounce time.Duration
+	DeletionGrace time.Duration
 	CookieSecure  bool
+
+	RevisionRetention int
+
+	// AccountLimiter is the login form's limiter; password confirmations
+	// in the settings count towards the same lockout.
+	AccountLimiter *auth.Limiter
 }
 
 func adminModule(deps adminDeps) *module.Module[adminDeps] {
 	mod := &module.Module[adminDeps]{
-		Name:        "admin",
-		BasePath:    "",
-		Deps:        deps,
-		Middlewares: []router.Middleware{requireAuth(deps.Sessions)},
+		Name:     "admin",
+		BasePath: "",
+		Deps:     deps,
+		Middlewares: []router.Middleware{
+			requireAuth(deps.Sessions),
+			requireCSRF(deps.Signer, deps.Templates.forbidden, deps.CookieSecure),
+		},
 		Routes: []module.Route[adminDeps]{
 			{Method: http.MethodGet, Path: "/admin", Handler: handleDashboard},
 			{Method: http.MethodPost, Path: "/admin/club", Handler: handleClubUpdate},
+			{Method: http.MethodGet, Path: "/admin/preview", Handler: handlePreview},
+			{Method: http.MethodPost, Path: "/admin/preview", Handler: handleFormPreview},
+			{Method: http.MethodPost, Path: "/admin/publish", Handler: handlePublish},
+			{Method: http.MethodGet, Path: "/admin/members", Handler: handleMembers},
+			{Method: http.MethodPost, Path: "/admin/members", Handler: handleMemberInvite},
+			{Method: http.MethodPost, Path: "/admin/members/role", Handler: handleMemberRole},
+			{Method: http.MethodPost, Path: "/admin/members/remove", Handler: handleMemberRemove},
+			{Method: http.MethodGet, Path: "/admin/history", Handler: handleHistory},
+			{Method: http.MethodGet, Path: "/admin/revisions", Handler: handleRevisions},
+			{Method: http.MethodPost, Path: "/admin/revisions/restore", Handler: handleRevisionRestore},
+			{Method: http.MethodGet, Path: "/admin/account", Handler: handleAccount},
+			{Method: http.MethodPost, Path: "/admin/account/email", Handler: handleAccountEmail},
+			{Method: http.MethodPost, Path: "/admin/account/password", Handler: handleAccountPassword},
+			{Method: http.MethodGet, Path: "/admin/account/export", Handler: handleAccountExport},
+			{Method: http.MethodPost, Path: "/admin/account/delete", Handler: handleAccountDelete},
+			{Method: http.MethodPost, Path: "/admin/account/delete/cancel", Handler: handleAccountDeleteCancel},
+			{Method: http.MethodGet, Path: "/admin/security", Handler: handleSecurity},
+			{Method: http.MethodPost, Path: "/admin/security/totp/start", Handler: handleTOTPStart},
+			{Method: http.MethodPost, Path: "/admin/security/totp/confirm", Handler: handleTOTPConfirm},
+			{Method: http.MethodPost, Path: "/admin/security/totp/disable", Handler: handleTOTPDisable},
+			{Method: http.MethodPost, Path: "/admin/verification/resend", Handler: handleVerificationResend},
+			{Method: http.MethodPost, Path: "/admin/impersonation/stop", Handler: handleImpersonationStop},
 			{Method: http.MethodPost, Path: "/logout", Handler: handleLogout},
 		},
 	}
@@ -46,86 +84,173 @@ func handleDashboard(ctx router.Context, deps adminDeps) {
 		return
 	}
 
-	club, hasClub := deps.Store.GetClubByOwner(userID)
+	user, ok := deps.Store.GetUser(userID)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	club, hasClub := deps.Store.GetClubForUser(userID)
+	membership, isMember := deps.Store.GetMembership(userID)
 	info := ""
-	if ctx.Request.URL.Query().Get("saved") == "1" {
-		info = "Club gespeichert."
+	errMsg := ""
+	switch {
+	case ctx.Request.URL.Query().Get("saved") == "1":
+		info = "Entwurf gespeichert. Die Aenderungen sind erst nach dem Veroeffentlichen sichtbar."
+	case ctx.Request.URL.Query().Get("published") == "1":
+		info = "Clubseite veroeffentlicht. Die Website wird neu gebaut."
+	case ctx.Request.URL.Query().Get("verified") == "1":
+		info = "E-Mail bestaetigt."
+	case ctx.Request.URL.Query().Get("verified") == "0":
+		errMsg = "Der Bestaetigungslink ist ungueltig oder abgelaufen."
+	case ctx.Request.URL.Query().Get("resent") == "1":
+		info = "Wir haben dir einen neuen Bestaetigungslink geschickt."
 	}
 
 	data := dashboardDataFromClub(club, hasClub)
 	data.Title = "Dashboard"
+	data.CSRFToken = csrfToken(ctx.Request)
 	data.Info = info
+	data.Error = errMsg
+	data.Email = user.Email
+	data.NeedsVerification = !user.Verified()
+	if user.DeletionScheduledAt != nil {
+		data.DeletionScheduled = dateTimeLabel(*user.DeletionScheduledAt)
+	}
+	data.IsPlatformAdmin = user.IsPlatformAdmin
+	if club.SuspendedAt != nil {
+		data.SuspendedReason = club.SuspendedReason
+		data.Suspended = true
+	}
+	if cookie, err := ctx.Request.Cookie(sessionCookieName); err == nil {
+		if impersonatorID, ok := deps.Sessions.Impersonator(cookie.Value); ok {
+			if operator, ok := deps.Store.GetUser(impersonatorID); ok {
+				data.ImpersonatedBy = operator.Email
+			}
+		}
+	}
+	applyMembership(&data, membership, isMember)
+	if hasClub {
+		applyPublicationState(&data, deps, club.ID)
+		applyBuildStatus(&data, deps, club.ID)
+	}
 
 	renderTemplate(ctx.Writer, deps.Templates.dashboard, data)
 }
 
 func handleClubUpdate(ctx router.Context, deps adminDeps) {
-	userID, ok := sessionUserID(deps.Sessions, ctx.Request)
+	userID, ok := verifiedUserID(ctx, deps)
 	if !ok {
-		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
 		return
 	}
 
-	existingClub, hasClub := deps.Store.GetClubByOwner(userID)
+	actor := sessionActor(deps.Sessions, ctx.Request, userID)
+	existingClub, hasClub := deps.Store.GetClubForUser(userID)
+	membership, isMember := deps.Store.GetMembership(userID)
 
 	if err := ctx.Request.ParseForm(); err != nil {
 		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
 		return
 	}
 
-	update := store.ClubUpdate{
-		Name:           ctx.Request.FormValue("name"),
-		Description:    ctx.Request.FormValue("description"),
-		Categories:     categoriesFromForm(ctx.Request),
-		ContactName:    ctx.Request.FormValue("contact_name"),
-		ContactRole:    ctx.Request.FormValue("contact_role"),
-		ContactEmail:   ctx.Request.FormValue("contact_email"),
-		ContactPhone:   ctx.Request.FormValue("contact_phone"),
-		ContactWebsite: ctx.Request.FormValue("contact_website"),
-		AddressLine1:   ctx.Request.FormValue("address_line1"),
-		AddressLine2:   ctx.Request.FormValue("address_line2"),
-		AddressPostal:  ctx.Request.FormValue("address_postal"),
-		AddressCity:    ctx.Request.FormValue("address_city"),
-		AddressCountry: ctx.Request.FormValue("address_country"),
+	if isMember && !membership.CanEditClub() {
+		if !membership.CanEditCourses() {
+			http.Error(ctx.Writer, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err := deps.Store.SaveClubCourses(actor, existingClub.ID, courseInputsFromForm(ctx.Request), deps.RevisionRetention); err != nil {
+			log.Printf("failed to save courses: %v", err)
+			data := dashboardDataFromForm(ctx.Request, existingClub.Slug)
+			data.Title = "Dashboard"
+			data.CSRFToken = csrfToken(ctx.Request)
+			data.Error = "Speichern fehlgeschlagen."
+			applyMembership(&data, membership, isMember)
+			renderTemplate(ctx.Writer, deps.Templates.dashboard, data)
+			return
+		}
+		http.Redirect(ctx.Writer, ctx.Request, "/admin?saved=1", http.StatusSeeOther)
+		return
 	}
 
-	club, err := deps.Store.UpsertClub(userID, update)
+	// Saving only touches the draft; the public site is rebuilt when the club
+	// is published.
+	_, err := deps.Store.SaveClubDraft(actor, clubUpdateFromForm(ctx.Request),
+		openingInputsFromForm(ctx.Request), courseInputsFromForm(ctx.Request), deps.RevisionRetention)
 	if err != nil {
+		if !errors.Is(err, store.ErrNameRequired) && !errors.Is(err, store.ErrNotAllowed) {
+			log.Printf("failed to save club: %v", err)
+		}
 		data := dashboardDataFromForm(ctx.Request, existingClub.Slug)
 		data.Title = "Dashboard"
+		data.CSRFToken = csrfToken(ctx.Request)
 		data.Error = clubErrorMessage(err)
-		if hasClub && existingClub.Slug != "" {
-			data.PreviewPath = "/clubs/" + existingClub.Slug + "/"
+		applyMembership(&data, membership, isMember)
+		if hasClub {
+			applyPublicationState(&data, deps, existingClub.ID)
 		}
 		renderTemplate(ctx.Writer, deps.Templates.dashboard, data)
 		return
 	}
 
-	openingInputs := openingInputsFromForm(ctx.Request)
-	if err := deps.Store.ReplaceOpeningHours(club.ID, openingInputs); err != nil {
-		data := dashboardDataFromForm(ctx.Request, club.Slug)
-		data.Title = "Dashboard"
-		data.Error = "Speichern fehlgeschlagen."
-		data.PreviewPath = "/clubs/" + club.Slug + "/"
-		renderTemplate(ctx.Writer, deps.Templates.dashboard, data)
+	http.Redirect(ctx.Writer, ctx.Request, "/admin?saved=1", http.StatusSeeOther)
+}
+
+func handleVerificationResend(ctx router.Context, deps adminDeps) {
+	userID, ok := sessionUserID(deps.Sessions, ctx.Request)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
 		return
 	}
 
-	courseInputs := courseInputsFromForm(ctx.Request)
-	if err := deps.Store.ReplaceCourses(club.ID, courseInputs); err != nil {
-		data := dashboardDataFromForm(ctx.Request, club.Slug)
-		data.Title = "Dashboard"
-		data.Error = "Speichern fehlgeschlagen."
-		data.PreviewPath = "/clubs/" + club.Slug + "/"
-		renderTemplate(ctx.Writer, deps.Templates.dashboard, data)
+	user, ok := deps.Store.GetUser(userID)
+	if !ok || user.Verified() {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
 		return
 	}
 
-	if err := deps.Store.EnqueueBuildTask(deps.BuildDebounce); err != nil {
-		log.Printf("failed to enqueue build task: %v", err)
+	if err := deps.Verifier.Send(user); err != nil {
+		log.Printf("failed to send verification mail: %v", err)
 	}
+	http.Redirect(ctx.Writer, ctx.Request, "/admin?resent=1", http.StatusSeeOther)
+}
 
-	http.Redirect(ctx.Writer, ctx.Request, "/admin?saved=1", http.StatusSeeOther)
+func handleImpersonationStop(ctx router.Context, deps adminDeps) {
+	cookie, err := ctx.Request.Cookie(sessionCookieName)
+	if err != nil {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	impersonatorID, ok := deps.Sessions.Impersonator(cookie.Value)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+		return
+	}
+	targetID, _ := deps.Sessions.Get(cookie.Value)
+	deps.Sessions.Delete(cookie.Value)
+
+	if err := deps.Store.RecordPlatformAction(store.PlatformAction{
+		ActorID:      impersonatorID,
+		Action:       store.PlatformActionImpersonationStop,
+		TargetUserID: targetID,
+	}); err != nil {
+		log.Printf("failed to record end of impersonation: %v", err)
+	}
+	log.Printf("platform admin %s stopped impersonating user %s", impersonatorID, targetID)
+
+	operator, ok := deps.Store.GetUser(impersonatorID)
+	if !ok || !operator.IsPlatformAdmin {
+		clearSessionCookie(ctx.Writer, deps.CookieSecure)
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	sessionToken, err := deps.Sessions.Create(operator.ID)
+	if err != nil {
+		clearSessionCookie(ctx.Writer, deps.CookieSecure)
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	setSessionCookie(ctx.Writer, sessionToken, deps.CookieSecure)
+	http.Redirect(ctx.Writer, ctx.Request, "/platform?done=impersonation", http.StatusSeeOther)
 }
 
 func handleLogout(ctx router.Context, deps adminDeps) {
@@ -148,6 +273,30 @@ func requireAuth(sessions *auth.Manager) router.Middleware {
 	}
 }
 
+func verifiedUserID(ctx router.Context, deps adminDeps) (string, bool) {
+	userID, ok := sessionUserID(deps.Sessions, ctx.Request)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return "", false
+	}
+	user, ok := deps.Store.GetUser(userID)
+	if !ok || !user.Verified() {
+		http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+		return "", false
+	}
+	return userID, true
+}
+
+// sessionActor attributes changes to userID and, while a platform admin
+// impersonates the account, to that admin as well.
+func sessionActor(sessions *auth.Manager, r *http.Request, userID string) store.Actor {
+	actor := store.Actor{UserID: userID}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		actor.ImpersonatorID, _ = sessions.Impersonator(cookie.Value)
+	}
+	return actor
+}
+
 func clubErrorMessage(err error) string {
 	if err == nil {
 		return ""
@@ -155,9 +304,22 @@ func clubErrorMessage(err error) string {
 	if errors.Is(err, store.ErrNameRequired) {
 		return "Bitte einen Clubnamen angeben."
 	}
+	if errors.Is(err, store.ErrNotAllowed) {
+		return "Dafuer fehlen dir die Berechtigungen."
+	}
 	return "Speichern fehlgeschlagen."
 }
 
+func applyMembership(data *dashboardData, membership store.ClubMembership, isMember bool) {
+	if !isMember {
+		data.CanEditClub = true
+		return
+	}
+	data.RoleLabel = roleLabel(membership.Role)
+	data.CanEditClub = membership.CanEditClub()
+	data.CanManageMembers = membership.CanManageMembers()
+}
+
 func dashboardDataFromClub(club store.Club, hasClub bool) dashboardData {
 	data := dashboardData{
 		AppName:         appName(),
@@ -180,9 +342,7 @@ func dashboardDataFromClub(club store.Club, hasClub bool) dashboardData {
 		Courses:         buildCourseRows(club.Courses),
 	}
 	data.CategorySelection, data.CategoryCustom = categorySelection(club.Categories)
-	if hasClub && club.Slug != "" {
-		data.PreviewPath = "/clubs/" + club.Slug + "/"
-	}
+	data.HasClub = hasClub
 	return data
 }
 
@@ -209,9 +369,7 @@ func dashboardDataFromForm(r *http.Request, clubSlug string) dashboardData {
 		Courses:         courseRowsFromForm(r),
 	}
 	data.CategorySelection, data.CategoryCustom = categorySelection(categories)
-	if clubSlug != "" {
-		data.PreviewPath = "/clubs/" + clubSlug + "/"
-	}
+	data.HasClub = clubSlug != ""
 	return data
 }
 
@@ -321,6 +479,24 @@ func courseRowsFromForm(r *http.Request) []courseRow {
 	return rows
 }
 
+func clubUpdateFromForm(r *http.Request) store.ClubUpdate {
+	return store.ClubUpdate{
+		Name:           r.FormValue("name"),
+		Description:    r.FormValue("description"),
+		Categories:     categoriesFromForm(r),
+		ContactName:    r.FormValue("contact_name"),
+		ContactRole:    r.FormValue("contact_role"),
+		ContactEmail:   r.FormValue("contact_email"),
+		ContactPhone:   r.FormValue("contact_phone"),
+		ContactWebsite: r.FormValue("contact_website"),
+		AddressLine1:   r.FormValue("address_line1"),
+		AddressLine2:   r.FormValue("address_line2"),
+		AddressPostal:  r.FormValue("address_postal"),
+		AddressCity:    r.FormValue("address_city"),
+		AddressCountry: r.FormValue("address_country"),
+	}
+}
+
 func openingInputsFromForm(r *http.Request) []store.OpeningHourInput {
 	rows := openingRowsFromForm(r)
 	inputs := make([]store.OpeningHourInput, 0, len(rows))
@@ -2,30 +2,51 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/club-portal/internal/mail"
 	"github.com/janmarkuslanger/club-portal/internal/store"
 	"github.com/janmarkuslanger/graft/module"
 	"github.com/janmarkuslanger/graft/router"
 )
 
 type authDeps struct {
-	Store        *store.Store
-	Sessions     *auth.Manager
-	Templates    templates
-	CookieSecure bool
+	Store            *store.Store
+	Sessions         *auth.Manager
+	Signer           *auth.Signer
+	Templates        templates
+	Mailer           mail.Mailer
+	Verifier         emailVerifier
+	BaseURL          string
+	PasswordResetTTL time.Duration
+	AccountLimiter   *auth.Limiter
+	IPLimiter        *auth.Limiter
+	TrustProxy       bool
+	CookieSecure     bool
 }
 
 func authModule(deps authDeps) *module.Module[authDeps] {
 	mod := &module.Module[authDeps]{
-		Name:     "auth",
-		BasePath: "",
-		Deps:     deps,
+		Name:        "auth",
+		BasePath:    "",
+		Deps:        deps,
+		Middlewares: []router.Middleware{requireCSRF(deps.Signer, deps.Templates.forbidden, deps.CookieSecure)},
 		Routes: []module.Route[authDeps]{
 			{Method: http.MethodPost, Path: "/login", Handler: handleLoginSubmit},
+			{Method: http.MethodGet, Path: "/login/2fa", Handler: handleTwoFactorForm},
+			{Method: http.MethodPost, Path: "/login/2fa", Handler: handleTwoFactorSubmit},
 			{Method: http.MethodPost, Path: "/register", Handler: handleRegisterSubmit},
+			{Method: http.MethodGet, Path: "/verify-email", Handler: handleVerifyEmail},
+			{Method: http.MethodGet, Path: "/forgot-password", Handler: handleForgotPasswordForm},
+			{Method: http.MethodPost, Path: "/forgot-password", Handler: handleForgotPasswordSubmit},
+			{Method: http.MethodGet, Path: "/reset-password", Handler: handleResetPasswordForm},
+			{Method: http.MethodPost, Path: "/reset-password", Handler: handleResetPasswordSubmit},
 		},
 	}
 	return mod
@@ -40,24 +61,152 @@ func handleLoginSubmit(ctx router.Context, deps authDeps) {
 	email := strings.TrimSpace(ctx.Request.FormValue("email"))
 	password := ctx.Request.FormValue("password")
 
+	now := time.Now()
+	ip := clientIP(ctx.Request, deps.TrustProxy)
+	ipKey := "login:" + ip
+	accountKey := accountLimitKey(email)
+	if wait, ok := throttled(deps, now, ipKey, accountKey); !ok {
+		data := loginData{
+			AppName:   appName(),
+			CSRFToken: csrfToken(ctx.Request),
+			Title:     "Login",
+			Error:     lockoutMessage(wait),
+			Email:     email,
+		}
+		renderTemplateStatus(ctx.Writer, http.StatusTooManyRequests, deps.Templates.login, data)
+		return
+	}
+
 	user, err := deps.Store.Authenticate(email, password)
 	if err != nil {
+		if errors.Is(err, store.ErrInvalidCredentials) {
+			if deps.IPLimiter.Fail(ipKey, now) {
+				log.Printf("login locked for ip %s after repeated failures", ip)
+			}
+			if deps.AccountLimiter.Fail(accountKey, now) {
+				log.Printf("login locked for account %q after repeated failures (last ip %s)", email, ip)
+			}
+		}
 		data := loginData{
-			AppName: appName(),
-			Title:   "Login",
-			Error:   "Login fehlgeschlagen. Bitte pruefe deine Daten.",
-			Email:   email,
+			AppName:   appName(),
+			CSRFToken: csrfToken(ctx.Request),
+			Title:     "Login",
+			Error:     "Login fehlgeschlagen. Bitte pruefe deine Daten.",
+			Email:     email,
 		}
 		renderTemplate(ctx.Writer, deps.Templates.login, data)
 		return
 	}
+	deps.AccountLimiter.Reset(accountKey)
 
-	sessionToken := deps.Sessions.Create(user.ID)
+	if user.TOTPEnabled() {
+		pendingToken, err := deps.Sessions.CreatePending(user.ID)
+		if err != nil {
+			http.Error(ctx.Writer, "session error", http.StatusInternalServerError)
+			return
+		}
+		setPreAuthCookie(ctx.Writer, pendingToken, deps.CookieSecure)
+		http.Redirect(ctx.Writer, ctx.Request, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	sessionToken, err := deps.Sessions.Create(user.ID)
+	if err != nil {
+		http.Error(ctx.Writer, "session error", http.StatusInternalServerError)
+		return
+	}
 	setSessionCookie(ctx.Writer, sessionToken, deps.CookieSecure)
 
 	http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
 }
 
+func handleTwoFactorForm(ctx router.Context, deps authDeps) {
+	if _, ok := pendingUserID(deps.Sessions, ctx.Request); !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := twoFactorData{
+		AppName:   appName(),
+		CSRFToken: csrfToken(ctx.Request),
+		Title:     "Zwei-Faktor-Anmeldung",
+	}
+	renderTemplate(ctx.Writer, deps.Templates.twoFactor, data)
+}
+
+func handleTwoFactorSubmit(ctx router.Context, deps authDeps) {
+	userID, ok := pendingUserID(deps.Sessions, ctx.Request)
+	if !ok {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	data := twoFactorData{
+		AppName:   appName(),
+		CSRFToken: csrfToken(ctx.Request),
+		Title:     "Zwei-Faktor-Anmeldung",
+	}
+
+	now := time.Now()
+	limitKey := "totp:" + userID
+	if wait, ok := deps.AccountLimiter.Check(limitKey, now); !ok {
+		data.Error = lockoutMessage(wait)
+		renderTemplateStatus(ctx.Writer, http.StatusTooManyRequests, deps.Templates.twoFactor, data)
+		return
+	}
+
+	user, ok := deps.Store.GetUser(userID)
+	if !ok || !user.TOTPEnabled() {
+		http.Redirect(ctx.Writer, ctx.Request, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := checkSecondFactor(deps.Store, user, ctx.Request.FormValue("code"), now); err != nil {
+		if deps.AccountLimiter.Fail(limitKey, now) {
+			log.Printf("two-factor login locked for account %q after repeated failures", user.Email)
+		}
+		data.Error = "Der Code ist ungueltig. Bitte versuche es erneut."
+		renderTemplate(ctx.Writer, deps.Templates.twoFactor, data)
+		return
+	}
+	deps.AccountLimiter.Reset(limitKey)
+
+	if cookie, err := ctx.Request.Cookie(preAuthCookieName); err == nil {
+		deps.Sessions.Delete(cookie.Value)
+	}
+	clearPreAuthCookie(ctx.Writer, deps.CookieSecure)
+
+	sessionToken, err := deps.Sessions.Create(user.ID)
+	if err != nil {
+		http.Error(ctx.Writer, "session error", http.StatusInternalServerError)
+		return
+	}
+	setSessionCookie(ctx.Writer, sessionToken, deps.CookieSecure)
+
+	http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+}
+
+// checkSecondFactor accepts a current authenticator code or an unused
+// recovery code; either one can only be used once.
+func checkSecondFactor(storeInstance *store.Store, user store.User, code string, now time.Time) error {
+	if step, valid := auth.VerifyTOTP(user.TOTPSecret, code, now); valid {
+		return storeInstance.ConsumeTOTPStep(user.ID, step)
+	}
+	return storeInstance.UseRecoveryCode(user.ID, code)
+}
+
+func pendingUserID(sessions *auth.Manager, r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(preAuthCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	return sessions.GetPending(cookie.Value)
+}
+
 func handleRegisterSubmit(ctx router.Context, deps authDeps) {
 	if err := ctx.Request.ParseForm(); err != nil {
 		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
@@ -67,27 +216,265 @@ func handleRegisterSubmit(ctx router.Context, deps authDeps) {
 	email := strings.TrimSpace(ctx.Request.FormValue("email"))
 	password := ctx.Request.FormValue("password")
 
+	now := time.Now()
+	ip := clientIP(ctx.Request, deps.TrustProxy)
+	ipKey := "register:" + ip
+	if wait, ok := throttled(deps, now, ipKey); !ok {
+		data := registerData{
+			AppName:      appName(),
+			CSRFToken:    csrfToken(ctx.Request),
+			Title:        "Registrieren",
+			Error:        lockoutMessage(wait),
+			Email:        email,
+			PasswordHint: passwordHint(deps.Store.PasswordPolicy()),
+		}
+		renderTemplateStatus(ctx.Writer, http.StatusTooManyRequests, deps.Templates.register, data)
+		return
+	}
 	user, err := deps.Store.CreateUser(email, password)
 	if err != nil {
+		// Only failed attempts count, so several members signing up from one
+		// club office are not throttled.
+		if deps.IPLimiter.Fail(ipKey, now) {
+			log.Printf("registration locked for ip %s after repeated attempts", ip)
+		}
 		msg := "Registrierung fehlgeschlagen."
 		switch {
 		case errors.Is(err, store.ErrEmailExists):
 			msg = "Diese E-Mail ist bereits registriert."
-		case errors.Is(err, store.ErrPasswordTooShort):
-			msg = "Passwort ist zu kurz."
+		default:
+			if passwordMsg, ok := passwordErrorMessage(err, deps.Store.PasswordPolicy()); ok {
+				msg = passwordMsg
+			}
 		}
 		data := registerData{
-			AppName: appName(),
-			Title:   "Registrieren",
-			Error:   msg,
-			Email:   email,
+			AppName:      appName(),
+			CSRFToken:    csrfToken(ctx.Request),
+			Title:        "Registrieren",
+			Error:        msg,
+			Email:        email,
+			PasswordHint: passwordHint(deps.Store.PasswordPolicy()),
 		}
 		renderTemplate(ctx.Writer, deps.Templates.register, data)
 		return
 	}
 
-	sessionToken := deps.Sessions.Create(user.ID)
+	if err := deps.Verifier.Send(user); err != nil {
+		log.Printf("failed to send verification mail: %v", err)
+	}
+
+	sessionToken, err := deps.Sessions.Create(user.ID)
+	if err != nil {
+		http.Error(ctx.Writer, "session error", http.StatusInternalServerError)
+		return
+	}
 	setSessionCookie(ctx.Writer, sessionToken, deps.CookieSecure)
 
 	http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
 }
+
+func throttled(deps authDeps, now time.Time, ipKey string, accountKeys ...string) (time.Duration, bool) {
+	wait, ok := deps.IPLimiter.Check(ipKey, now)
+	for _, key := range accountKeys {
+		accountWait, accountOK := deps.AccountLimiter.Check(key, now)
+		if !accountOK {
+			ok = false
+			if accountWait > wait {
+				wait = accountWait
+			}
+		}
+	}
+	return wait, ok
+}
+
+// accountLimitKey is shared by the login form and every password
+// confirmation of a logged-in user, so they count towards one lockout.
+func accountLimitKey(email string) string {
+	return "account:" + strings.ToLower(email)
+}
+
+func lockoutMessage(wait time.Duration) string {
+	return "Zu viele Versuche. Bitte warte " + durationLabel(wait) + " und versuche es dann erneut."
+}
+
+func handleVerifyEmail(ctx router.Context, deps authDeps) {
+	target := "/login"
+	if _, ok := sessionUserID(deps.Sessions, ctx.Request); ok {
+		target = "/admin"
+	}
+
+	userID, email, err := deps.Verifier.Verify(ctx.Request.URL.Query().Get("token"))
+	if err == nil {
+		err = deps.Store.MarkEmailVerified(userID, email)
+	}
+	if err != nil {
+		http.Redirect(ctx.Writer, ctx.Request, target+"?verified=0", http.StatusSeeOther)
+		return
+	}
+
+	if club, hasClub := deps.Store.GetClubForUser(userID); hasClub {
+		if err := deps.Store.EnqueueClubBuildTask(club.ID, 0); err != nil {
+			log.Printf("failed to enqueue build task: %v", err)
+		}
+	}
+
+	http.Redirect(ctx.Writer, ctx.Request, target+"?verified=1", http.StatusSeeOther)
+}
+
+func handleForgotPasswordForm(ctx router.Context, deps authDeps) {
+	data := forgotPasswordData{
+		AppName:   appName(),
+		CSRFToken: csrfToken(ctx.Request),
+		Title:     "Passwort vergessen",
+		Email:     ctx.Request.URL.Query().Get("email"),
+	}
+	renderTemplate(ctx.Writer, deps.Templates.forgotPassword, data)
+}
+
+func handleForgotPasswordSubmit(ctx router.Context, deps authDeps) {
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(ctx.Request.FormValue("email"))
+	token, user, err := deps.Store.CreatePasswordResetToken(email, deps.PasswordResetTTL)
+	switch {
+	case err == nil:
+		link := deps.BaseURL + "/reset-password?token=" + url.QueryEscape(token)
+		msg := mail.Message{
+			To:      user.Email,
+			Subject: appName() + ": Passwort zuruecksetzen",
+			Body: "Hallo,\n\n" +
+				"du hast angefordert, dein Passwort zurueckzusetzen. Oeffne dazu diesen Link:\n\n" +
+				link + "\n\n" +
+				"Der Link ist " + durationLabel(deps.PasswordResetTTL) + " gueltig und kann nur einmal verwendet werden.\n" +
+				"Wenn du das nicht warst, kannst du diese E-Mail ignorieren.\n",
+		}
+		if err := deps.Mailer.Send(msg); err != nil {
+			log.Printf("failed to send password reset mail: %v", err)
+		}
+	case errors.Is(err, store.ErrUserNotFound):
+	default:
+		log.Printf("failed to create password reset token: %v", err)
+	}
+
+	// Always answer the same way so the form cannot be used to probe for
+	// registered addresses.
+	data := forgotPasswordData{
+		AppName:   appName(),
+		CSRFToken: csrfToken(ctx.Request),
+		Title:     "Passwort vergessen",
+		Info:      "Falls ein Konto mit dieser E-Mail existiert, haben wir dir einen Link geschickt.",
+		Email:     email,
+	}
+	renderTemplate(ctx.Writer, deps.Templates.forgotPassword, data)
+}
+
+func handleResetPasswordForm(ctx router.Context, deps authDeps) {
+	token := ctx.Request.URL.Query().Get("token")
+	data := resetPasswordData{
+		AppName:      appName(),
+		CSRFToken:    csrfToken(ctx.Request),
+		Title:        "Neues Passwort",
+		Token:        token,
+		PasswordHint: passwordHint(deps.Store.PasswordPolicy()),
+	}
+	if !deps.Store.ValidPasswordResetToken(token) {
+		data.Error = "Der Link ist ungueltig oder abgelaufen."
+		data.Token = ""
+	}
+	renderTemplate(ctx.Writer, deps.Templates.resetPassword, data)
+}
+
+func handleResetPasswordSubmit(ctx router.Context, deps authDeps) {
+	if err := ctx.Request.ParseForm(); err != nil {
+		http.Error(ctx.Writer, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	token := ctx.Request.FormValue("token")
+	password := ctx.Request.FormValue("password")
+	if password != ctx.Request.FormValue("password_confirm") {
+		data := resetPasswordData{
+			AppName:      appName(),
+			CSRFToken:    csrfToken(ctx.Request),
+			Title:        "Neues Passwort",
+			Error:        "Die Passwoerter stimmen nicht ueberein.",
+			Token:        token,
+			PasswordHint: passwordHint(deps.Store.PasswordPolicy()),
+		}
+		renderTemplate(ctx.Writer, deps.Templates.resetPassword, data)
+		return
+	}
+
+	user, err := deps.Store.ResetPassword(token, password)
+	if err != nil {
+		data := resetPasswordData{
+			AppName:      appName(),
+			CSRFToken:    csrfToken(ctx.Request),
+			Title:        "Neues Passwort",
+			Error:        "Passwort konnte nicht geaendert werden.",
+			Token:        token,
+			PasswordHint: passwordHint(deps.Store.PasswordPolicy()),
+		}
+		switch {
+		case errors.Is(err, store.ErrInvalidResetToken):
+			data.Error = "Der Link ist ungueltig oder abgelaufen."
+			data.Token = ""
+		default:
+			if passwordMsg, ok := passwordErrorMessage(err, deps.Store.PasswordPolicy()); ok {
+				data.Error = passwordMsg
+			}
+		}
+		renderTemplate(ctx.Writer, deps.Templates.resetPassword, data)
+		return
+	}
+
+	if err := deps.Sessions.DeleteUser(user.ID); err != nil {
+		log.Printf("failed to revoke sessions after password reset: %v", err)
+	}
+	clearSessionCookie(ctx.Writer, deps.CookieSecure)
+
+	http.Redirect(ctx.Writer, ctx.Request, "/login?reset=1", http.StatusSeeOther)
+}
+
+func passwordErrorMessage(err error, policy store.PasswordPolicy) (string, bool) {
+	switch {
+	case errors.Is(err, store.ErrPasswordTooShort):
+		return fmt.Sprintf("Das Passwort ist zu kurz (mindestens %d Zeichen).", policy.MinLength), true
+	case errors.Is(err, store.ErrPasswordTooLong):
+		return fmt.Sprintf("Das Passwort ist zu lang (hoechstens %d Byte).", policy.MaxLength), true
+	case errors.Is(err, store.ErrPasswordNeedsUpper):
+		return "Das Passwort braucht mindestens einen Grossbuchstaben.", true
+	case errors.Is(err, store.ErrPasswordNeedsLower):
+		return "Das Passwort braucht mindestens einen Kleinbuchstaben.", true
+	case errors.Is(err, store.ErrPasswordNeedsDigit):
+		return "Das Passwort braucht mindestens eine Ziffer.", true
+	case errors.Is(err, store.ErrPasswordNeedsSymbol):
+		return "Das Passwort braucht mindestens ein Sonderzeichen.", true
+	case errors.Is(err, store.ErrPasswordContainsEmail):
+		return "Das Passwort darf deine E-Mail-Adresse nicht enthalten.", true
+	case errors.Is(err, store.ErrPasswordTooCommon):
+		return "Dieses Passwort ist zu verbreitet. Bitte waehle ein anderes.", true
+	default:
+		return "", false
+	}
+}
+
+func passwordHint(policy store.PasswordPolicy) string {
+	parts := []string{fmt.Sprintf("mindestens %d Zeichen", policy.MinLength)}
+	if policy.RequireUpper {
+		parts = append(parts, "Grossbuchstabe")
+	}
+	if policy.RequireLower {
+		parts = append(parts, "Kleinbuchstabe")
+	}
+	if policy.RequireDigit {
+		parts = append(parts, "Ziffer")
+	}
+	if policy.RequireSymbol {
+		parts = append(parts, "Sonderzeichen")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+	"github.com/janmarkuslanger/graft/module"
+	"github.com/janmarkuslanger/graft/router"
+)
+
+const platformListLimit = 100
+
+const platformBuildRunLimit = 20
+
+// Workers renew their registry entry every few seconds; one that has been
+// silent for longer is most likely gone.
+const workerStaleAfter = 2 * time.Minute
+
+type platformDeps struct {
+	Store        *store.Store
+	Sessions     *auth.Manager
+	Signer       *auth.Signer
+	Templates    templates
+	CookieSecure bool
+}
+
+func platformModule(deps platformDeps) *module.Module[platformDeps] {
+	mod := &module.Module[platformDeps]{
+		Name:     "platform",
+		BasePath: "",
+		Deps:     deps,
+		Middlewares: []router.Middleware{
+			requirePlatformAdmin(deps.Store, deps.Sessions),
+			requireCSRF(deps.Signer, deps.Templates.forbidden, deps.CookieSecure),
+		},
+		Routes: []module.Route[platformDeps]{
+			{Method: http.MethodGet, Path: "/platform", Handler: handlePlatform},
+			{Method: http.MethodPost, Path: "/platform/clubs/suspend", Handler: handleClubSuspend},
+			{Method: http.MethodPost, Path: "/platform/clubs/unsuspend", Handler: handleClubUnsuspend},
+			{Method: http.MethodPost, Path: "/platform/impersonate", Handler: handleImpersonate},
+		},
+	}
+	return mod
+}
+
+// requirePlatformAdmin answers 404 to everyone else so the console does not
+// advertise itself. Impersonation sessions never pass, even if the target
+// happens to be an operator.
+func requirePlatformAdmin(storeInstance *store.Store, sessions *auth.Manager) router.Middleware {
+	return func(ctx router.Context, next router.HandlerFunc) {
+		if _, ok := platformAdminID(storeInstance, sessions, ctx.Request); !ok {
+			http.NotFound(ctx.Writer, ctx.Request)
+			return
+		}
+		next(ctx)
+	}
+}
+
+func platformAdminID(storeInstance *store.Store, sessions *auth.Manager, r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false
+	}
+	if _, impersonating := sessions.Impersonator(cookie.Value); impersonating {
+		return "", false
+	}
+	userID, ok := sessions.Get(cookie.Value)
+	if !ok {
+		return "", false
+	}
+	user, ok := storeInstance.GetUser(userID)
+	if !ok || !user.IsPlatformAdmin || !user.Verified() {
+		return "", false
+	}
+	return userID, true
+}
+
+func handlePlatform(ctx router.Context, deps platformDeps) {
+	info := ""
+	switch ctx.Request.URL.Query().Get("done") {
+	case "suspended":
+		info = "Club gesperrt. Die Seite verschwindet mit dem naechsten Build."
+	case "unsuspended":
+		info = "Club wieder freigegeben."
+	case "impersonation":
+		info = "Impersonation beendet."
+	}
+	renderPlatform(ctx, deps, "", info)
+}
+
+func handleClubSuspend(ctx router.Context, deps platformDeps) {
+	actorID, ok := platformAdminID(deps.Store, deps.Sessions, ctx.Request)
+	if !ok {
+		http.NotFound(ctx.Writer, ctx.Request)
+		return
+	}
+
+	clubID := ctx.Request.FormValue("club_id")
+	if err := deps.Store.SuspendClub(actorID, clubID, ctx.Request.FormValue("reason")); err != nil {
+		renderPlatform(ctx, deps, platformErrorMessage(err), "")
+		return
+	}
+	log.Printf("platform admin %s suspended club %s", actorID, clubID)
+
+	if err := deps.Store.EnqueueClubBuildTask(clubID, 0); err != nil {
+		log.Printf("failed to enqueue build task: %v", err)
+	}
+	http.Redirect(ctx.Writer, ctx.Request, "/platform?done=suspended", http.StatusSeeOther)
+}
+
+func handleClubUnsuspend(ctx router.Context, deps platformDeps) {
+	actorID, ok := platformAdminID(deps.Store, deps.Sessions, ctx.Request)
+	if !ok {
+		http.NotFound(ctx.Writer, ctx.Request)
+		return
+	}
+
+	clubID := ctx.Request.FormValue("club_id")
+	if err := deps.Store.UnsuspendClub(actorID, clubID); err != nil {
+		renderPlatform(ctx, deps, platformErrorMessage(err), "")
+		return
+	}
+	log.Printf("platform admin %s unsuspended club %s", actorID, clubID)
+
+	if err := deps.Store.EnqueueClubBuildTask(clubID, 0); err != nil {
+		log.Printf("failed to enqueue build task: %v", err)
+	}
+	http.Redirect(ctx.Writer, ctx.Request, "/platform?done=unsuspended", http.StatusSeeOther)
+}
+
+func handleImpersonate(ctx router.Context, deps platformDeps) {
+	actorID, ok := platformAdminID(deps.Store, deps.Sessions, ctx.Request)
+	if !ok {
+		http.NotFound(ctx.Writer, ctx.Request)
+		return
+	}
+
+	target, ok := deps.Store.GetUser(ctx.Request.FormValue("user_id"))
+	if !ok {
+		renderPlatform(ctx, deps, "Konto nicht gefunden.", "")
+		return
+	}
+	if target.ID == actorID || target.IsPlatformAdmin {
+		renderPlatform(ctx, deps, "Andere Plattform-Admins koennen nicht uebernommen werden.", "")
+		return
+	}
+
+	if err := deps.Store.RecordPlatformAction(store.PlatformAction{
+		ActorID:      actorID,
+		Action:       store.PlatformActionImpersonationStart,
+		TargetUserID: target.ID,
+	}); err != nil {
+		renderPlatform(ctx, deps, "Impersonation fehlgeschlagen.", "")
+		return
+	}
+
+	token, err := deps.Sessions.CreateImpersonation(target.ID, actorID)
+	if err != nil {
+		renderPlatform(ctx, deps, "Impersonation fehlgeschlagen.", "")
+		return
+	}
+	log.Printf("platform admin %s started impersonating user %s", actorID, target.ID)
+
+	// The operator's own session is dropped and re-created when the
+	// impersonation ends, so the browser only ever holds one identity.
+	if cookie, err := ctx.Request.Cookie(sessionCookieName); err == nil {
+		deps.Sessions.Delete(cookie.Value)
+	}
+	setSessionCookie(ctx.Writer, token, deps.CookieSecure)
+	http.Redirect(ctx.Writer, ctx.Request, "/admin", http.StatusSeeOther)
+}
+
+func renderPlatform(ctx router.Context, deps platformDeps, errMsg, info string) {
+	query := ctx.Request.URL.Query().Get("q")
+	data := platformData{
+		AppName:   appName(),
+		CSRFToken: csrfToken(ctx.Request),
+		Title:     "Plattform",
+		Error:     errMsg,
+		Info:      info,
+		Query:     query,
+	}
+
+	users, err := deps.Store.SearchUsers(query, platformListLimit)
+	if err != nil {
+		log.Printf("platform user search failed: %v", err)
+	}
+	for _, user := range users {
+		data.Users = append(data.Users, platformUserRow{
+			ID:              user.ID,
+			Email:           user.Email,
+			Verified:        user.VerifiedAt != nil,
+			IsPlatformAdmin: user.IsPlatformAdmin,
+			PendingDeletion: user.DeletionScheduledAt != nil,
+			ClubName:        user.ClubName,
+			RoleLabel:       roleLabel(user.Role),
+			CreatedAt:       dateTimeLabel(user.CreatedAt),
+		})
+	}
+
+	clubs, err := deps.Store.SearchClubs(query, platformListLimit)
+	if err != nil {
+		log.Printf("platform club search failed: %v", err)
+	}
+	for _, club := range clubs {
+		data.Clubs = append(data.Clubs, platformClubRow{
+			ID:              club.ID,
+			Name:            club.Name,
+			PagePath:        "/clubs/" + club.Slug + "/",
+			OwnerEmail:      club.OwnerEmail,
+			Suspended:       club.SuspendedAt != nil,
+			SuspendedReason: club.SuspendedReason,
+		})
+	}
+
+	actions, err := deps.Store.RecentPlatformActions(50)
+	if err != nil {
+		log.Printf("platform action log failed: %v", err)
+	}
+	for _, action := range actions {
+		data.Actions = append(data.Actions, platformActionRow{
+			When:   dateTimeLabel(action.CreatedAt),
+			Actor:  action.ActorEmail,
+			Action: platformActionLabel(action.Action),
+			Target: platformActionTarget(action),
+			Detail: action.Detail,
+		})
+	}
+
+	data.Workers = platformWorkers(deps.Store)
+
+	runs, err := deps.Store.RecentBuildRuns(platformBuildRunLimit)
+	if err != nil {
+		log.Printf("platform build run list failed: %v", err)
+	}
+	for _, run := range runs {
+		data.BuildRuns = append(data.BuildRuns, platformBuildRunRow{
+			When:     dateTimeLabel(run.StartedAt),
+			Scope:    buildScopeLabel(run),
+			Worker:   run.WorkerID,
+			Status:   buildRunStatusLabel(run.Status),
+			Failed:   run.Status == store.BuildRunFailed,
+			Duration: runDurationLabel(run),
+			Error:    run.Error,
+		})
+	}
+
+	renderTemplate(ctx.Writer, deps.Templates.platform, data)
+}
+
+func platformWorkers(storeInstance *store.Store) []platformWorkerRow {
+	workers, err := storeInstance.Workers()
+	if err != nil {
+		log.Printf("platform worker list failed: %v", err)
+		return nil
+	}
+	now := time.Now()
+	leader, leading, err := storeInstance.Leader(store.LeaderBuild, now)
+	if err != nil {
+		log.Printf("platform leader lookup failed: %v", err)
+	}
+
+	rows := make([]platformWorkerRow, 0, len(workers))
+	for _, worker := range workers {
+		rows = append(rows, platformWorkerRow{
+			ID:          worker.ID,
+			Hostname:    worker.Hostname,
+			StartedAt:   dateTimeLabel(worker.StartedAt),
+			HeartbeatAt: dateTimeLabel(worker.HeartbeatAt),
+			Leader:      leading && leader.WorkerID == worker.ID,
+			Stale:       now.Sub(worker.HeartbeatAt) > workerStaleAfter,
+		})
+	}
+	return rows
+}
+
+func platformErrorMessage(err error) string {
+	if errors.Is(err, store.ErrClubNotFound) {
+		return "Club nicht gefunden."
+	}
+	return "Aktion fehlgeschlagen."
+}
+
+func platformActionLabel(action string) string {
+	switch action {
+	case store.PlatformActionSuspend:
+		return "Club gesperrt"
+	case store.PlatformActionUnsuspend:
+		return "Club freigegeben"
+	case store.PlatformActionImpersonationStart:
+		return "Impersonation gestartet"
+	case store.PlatformActionImpersonationStop:
+		return "Impersonation beendet"
+	default:
+		return action
+	}
+}
+
+func platformActionTarget(action store.PlatformActionEntry) string {
+	if action.ClubName != "" {
+		return action.ClubName
+	}
+	return action.TargetEmail
+}
+
+func buildScopeLabel(run store.BuildRun) string {
+	if run.Scope == store.BuildScopeSite {
+		return "Alle Clubs"
+	}
+	if run.ClubCount == 1 {
+		return "1 Club"
+	}
+	return strconv.Itoa(run.ClubCount) + " Clubs"
+}
@@ -12,16 +12,19 @@ import (
 )
 
 type publicDeps struct {
-	Sessions  *auth.Manager
-	Templates templates
-	Store     *store.Store
+	Sessions     *auth.Manager
+	Signer       *auth.Signer
+	Templates    templates
+	Store        *store.Store
+	CookieSecure bool
 }
 
 func publicModule(deps publicDeps) *module.Module[publicDeps] {
 	mod := &module.Module[publicDeps]{
-		Name:     "public",
-		BasePath: "",
-		Deps:     deps,
+		Name:        "public",
+		BasePath:    "",
+		Deps:        deps,
+		Middlewares: []router.Middleware{requireCSRF(deps.Signer, deps.Templates.forbidden, deps.CookieSecure)},
 		Routes: []module.Route[publicDeps]{
 			{Method: http.MethodGet, Path: "/", Handler: handleHome},
 			{Method: http.MethodGet, Path: "/login", Handler: handleLoginForm},
@@ -44,10 +47,20 @@ func handleLoginForm(ctx router.Context, deps publicDeps) {
 	}
 
 	data := loginData{
-		AppName: appName(),
-		Title:   "Login",
-		Error:   errorMessage(ctx.Request.URL.Query().Get("error")),
-		Email:   ctx.Request.URL.Query().Get("email"),
+		AppName:   appName(),
+		CSRFToken: csrfToken(ctx.Request),
+		Title:     "Login",
+		Error:     errorMessage(ctx.Request.URL.Query().Get("error")),
+		Email:     ctx.Request.URL.Query().Get("email"),
+	}
+	if ctx.Request.URL.Query().Get("reset") == "1" {
+		data.Info = "Passwort geaendert. Bitte melde dich neu an."
+	}
+	switch ctx.Request.URL.Query().Get("verified") {
+	case "1":
+		data.Info = "E-Mail bestaetigt. Bitte melde dich an."
+	case "0":
+		data.Error = "Der Bestaetigungslink ist ungueltig oder abgelaufen."
 	}
 
 	renderTemplate(ctx.Writer, deps.Templates.login, data)
@@ -60,10 +73,12 @@ func handleRegisterForm(ctx router.Context, deps publicDeps) {
 	}
 
 	data := registerData{
-		AppName: appName(),
-		Title:   "Registrieren",
-		Error:   errorMessage(ctx.Request.URL.Query().Get("error")),
-		Email:   ctx.Request.URL.Query().Get("email"),
+		AppName:      appName(),
+		CSRFToken:    csrfToken(ctx.Request),
+		Title:        "Registrieren",
+		Error:        errorMessage(ctx.Request.URL.Query().Get("error")),
+		Email:        ctx.Request.URL.Query().Get("email"),
+		PasswordHint: passwordHint(deps.Store.PasswordPolicy()),
 	}
 
 	renderTemplate(ctx.Writer, deps.Templates.register, data)
@@ -13,6 +13,9 @@ type seedModule struct {
 
 func (m seedModule) BuildRoutes(r router.Router) {}
 
+// OnUse is empty; it makes the module a graft.HookModule so OnStart runs.
+func (m seedModule) OnUse() {}
+
 func (m seedModule) OnStart() {
 	if m.Store == nil {
 		return
@@ -23,6 +26,6 @@ func (m seedModule) OnStart() {
 		log.Fatal(err)
 	}
 	if created {
-		log.Printf("seeded example club %q (login: %s / %s)", seed.Club.Name, seed.Email, seed.Password)
+		log.Printf("seeded example club %q (login: %s)", seed.Club.Name, seed.Email)
 	}
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+type storeSessions struct {
+	store *store.Store
+}
+
+func (s storeSessions) SaveSession(token string, session auth.Session) error {
+	return s.store.SaveSession(token, session.UserID, session.ImpersonatorID, session.ExpiresAt, session.Pending)
+}
+
+func (s storeSessions) RefreshSession(token string, session auth.Session) error {
+	return s.store.RefreshSession(token, session.UserID, session.ExpiresAt)
+}
+
+func (s storeSessions) LoadSession(token string) (auth.Session, bool, error) {
+	session, ok, err := s.store.GetSession(token)
+	if err != nil || !ok {
+		return auth.Session{}, ok, err
+	}
+	return auth.Session{
+		UserID:         session.UserID,
+		ExpiresAt:      session.ExpiresAt,
+		Pending:        session.Pending,
+		ImpersonatorID: session.ImpersonatorID,
+	}, true, nil
+}
+
+func (s storeSessions) DeleteSession(token string) error {
+	return s.store.DeleteSession(token)
+}
+
+func (s storeSessions) DeleteUserSessions(userID string) error {
+	return s.store.DeleteUserSessions(userID)
+}
+
+func (s storeSessions) DeleteExpiredSessions(now time.Time) (int64, error) {
+	return s.store.DeleteExpiredSessions(now)
+}
@@ -9,7 +9,18 @@ type templates struct {
 	login     *template.Template
 	register  *template.Template
 	dashboard *template.Template
+	members   *template.Template
 	home      *template.Template
+
+	forgotPassword *template.Template
+	resetPassword  *template.Template
+	forbidden      *template.Template
+	twoFactor      *template.Template
+	security       *template.Template
+	account        *template.Template
+	platform       *template.Template
+	history        *template.Template
+	revisions      *template.Template
 }
 
 func loadTemplates(dir string) (templates, error) {
@@ -29,6 +40,46 @@ func loadTemplates(dir string) (templates, error) {
 	if err != nil {
 		return templates{}, err
 	}
+	members, err := template.New("members.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "members.html"))
+	if err != nil {
+		return templates{}, err
+	}
+	forgotPassword, err := template.New("forgot_password.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "forgot_password.html"))
+	if err != nil {
+		return templates{}, err
+	}
+	resetPassword, err := template.New("reset_password.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "reset_password.html"))
+	if err != nil {
+		return templates{}, err
+	}
+	forbidden, err := template.New("forbidden.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "forbidden.html"))
+	if err != nil {
+		return templates{}, err
+	}
+	twoFactor, err := template.New("two_factor.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "two_factor.html"))
+	if err != nil {
+		return templates{}, err
+	}
+	security, err := template.New("security.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "security.html"))
+	if err != nil {
+		return templates{}, err
+	}
+	account, err := template.New("account.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "account.html"))
+	if err != nil {
+		return templates{}, err
+	}
+	platform, err := template.New("platform.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "platform.html"))
+	if err != nil {
+		return templates{}, err
+	}
+	history, err := template.New("history.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "history.html"))
+	if err != nil {
+		return templates{}, err
+	}
+	revisions, err := template.New("revisions.html").Funcs(funcs).ParseFiles(filepath.Join(dir, "revisions.html"))
+	if err != nil {
+		return templates{}, err
+	}
 	home, err := template.New("home.html").Funcs(funcs).ParseFiles(filepath.Join("templates", "public", "home.html"))
 	if err != nil {
 		return templates{}, err
@@ -38,6 +89,17 @@ func loadTemplates(dir string) (templates, error) {
 		login:     login,
 		register:  register,
 		dashboard: dashboard,
+		members:   members,
 		home:      home,
+
+		forgotPassword: forgotPassword,
+		resetPassword:  resetPassword,
+		forbidden:      forbidden,
+		twoFactor:      twoFactor,
+		security:       security,
+		account:        account,
+		platform:       platform,
+		history:        history,
+		revisions:      revisions,
 	}, nil
 }
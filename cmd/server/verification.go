@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/auth"
+	"github.com/janmarkuslanger/club-portal/internal/mail"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+type emailVerifier struct {
+	Signer  *auth.Signer
+	Mailer  mail.Mailer
+	BaseURL string
+	TTL     time.Duration
+}
+
+func (v emailVerifier) Send(user store.User) error {
+	token := v.Signer.Sign(user.ID+"|"+user.Email, time.Now().Add(v.TTL))
+	link := v.BaseURL + "/verify-email?token=" + url.QueryEscape(token)
+
+	return v.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: appName() + ": E-Mail bestaetigen",
+		Body: "Hallo,\n\n" +
+			"bitte bestaetige deine E-Mail-Adresse, damit du deinen Club verwalten kannst:\n\n" +
+			link + "\n\n" +
+			"Der Link ist " + durationLabel(v.TTL) + " gueltig.\n" +
+			"Wenn du dich nicht registriert hast, kannst du diese E-Mail ignorieren.\n",
+	})
+}
+
+func (v emailVerifier) Verify(token string) (string, string, error) {
+	payload, err := v.Signer.Verify(token, time.Now())
+	if err != nil {
+		return "", "", err
+	}
+	userID, email, ok := strings.Cut(payload, "|")
+	if !ok {
+		return "", "", auth.ErrInvalidSignature
+	}
+	return userID, email, nil
+}
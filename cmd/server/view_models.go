@@ -3,24 +3,91 @@ package main
 import "html/template"
 
 type loginData struct {
-	AppName string
-	Title   string
-	Error   string
-	Email   string
+	AppName   string
+	Title     string
+	Error     string
+	Info      string
+	Email     string
+	CSRFToken string
 }
 
 type registerData struct {
-	AppName string
-	Title   string
-	Error   string
-	Email   string
+	AppName      string
+	Title        string
+	Error        string
+	Email        string
+	CSRFToken    string
+	PasswordHint string
+}
+
+type twoFactorData struct {
+	AppName   string
+	CSRFToken string
+	Title     string
+	Error     string
+}
+
+type accountData struct {
+	AppName           string
+	CSRFToken         string
+	Title             string
+	Error             string
+	Info              string
+	Email             string
+	NewEmail          string
+	NeedsVerification bool
+	PasswordHint      string
+
+	DeletionGrace       string
+	DeletionScheduledAt string
+}
+
+type securityData struct {
+	AppName                string
+	CSRFToken              string
+	Title                  string
+	Error                  string
+	Info                   string
+	Email                  string
+	TOTPEnabled            bool
+	TOTPPending            bool
+	Secret                 string
+	ProvisioningURI        template.URL
+	RecoveryCodes          []string
+	RemainingRecoveryCodes int64
+}
+
+type forgotPasswordData struct {
+	AppName   string
+	Title     string
+	Error     string
+	Info      string
+	Email     string
+	CSRFToken string
+}
+
+type resetPasswordData struct {
+	AppName      string
+	Title        string
+	Error        string
+	Token        string
+	CSRFToken    string
+	PasswordHint string
 }
 
 type dashboardData struct {
 	AppName           string
+	CSRFToken         string
 	Title             string
 	Error             string
 	Info              string
+	Email             string
+	NeedsVerification bool
+	DeletionScheduled string
+	IsPlatformAdmin   bool
+	ImpersonatedBy    string
+	Suspended         bool
+	SuspendedReason   string
 	ClubName          string
 	ClubDescription   string
 	ClubCategories    string
@@ -28,7 +95,17 @@ type dashboardData struct {
 	CategorySelection map[string]bool
 	CategoryCustom    string
 	ClubSlug          string
-	PreviewPath       string
+	HasClub           bool
+	PublicPath        string
+	PublishedAt       string
+	HasDraftChanges   bool
+	BuildState        string
+	BuildMessage      string
+	BuildError        string
+	BuildRuns         []buildRunRow
+	RoleLabel         string
+	CanEditClub       bool
+	CanManageMembers  bool
 	ContactName       string
 	ContactRole       string
 	ContactEmail      string
@@ -43,6 +120,37 @@ type dashboardData struct {
 	Courses           []courseRow
 }
 
+type membersData struct {
+	AppName          string
+	CSRFToken        string
+	Title            string
+	Error            string
+	Info             string
+	ClubName         string
+	CanManageMembers bool
+	Members          []memberRow
+	RoleOptions      []roleOption
+}
+
+type memberRow struct {
+	UserID    string
+	Email     string
+	Role      string
+	RoleLabel string
+	IsSelf    bool
+}
+
+type roleOption struct {
+	Value string
+	Label string
+}
+
+type forbiddenData struct {
+	AppName string
+	Title   string
+	Message string
+}
+
 type homeData struct {
 	AppName    string
 	Title      string
@@ -88,3 +196,122 @@ type courseRow struct {
 	Level       string
 	Description string
 }
+
+type platformData struct {
+	AppName   string
+	CSRFToken string
+	Title     string
+	Error     string
+	Info      string
+	Query     string
+	Users     []platformUserRow
+	Clubs     []platformClubRow
+	Actions   []platformActionRow
+	Workers   []platformWorkerRow
+	BuildRuns []platformBuildRunRow
+}
+
+type platformUserRow struct {
+	ID              string
+	Email           string
+	Verified        bool
+	IsPlatformAdmin bool
+	PendingDeletion bool
+	ClubName        string
+	RoleLabel       string
+	CreatedAt       string
+}
+
+type platformClubRow struct {
+	ID              string
+	Name            string
+	PagePath        string
+	OwnerEmail      string
+	Suspended       bool
+	SuspendedReason string
+}
+
+type platformActionRow struct {
+	When   string
+	Actor  string
+	Action string
+	Target string
+	Detail string
+}
+
+type platformWorkerRow struct {
+	ID          string
+	Hostname    string
+	StartedAt   string
+	HeartbeatAt string
+	Leader      bool
+	Stale       bool
+}
+
+type platformBuildRunRow struct {
+	When     string
+	Scope    string
+	Worker   string
+	Status   string
+	Failed   bool
+	Duration string
+	Error    string
+}
+
+type historyData struct {
+	AppName   string
+	CSRFToken string
+	Title     string
+	Error     string
+	ClubName  string
+	Entries   []historyRow
+}
+
+type buildRunRow struct {
+	When     string
+	Status   string
+	Failed   bool
+	Duration string
+}
+
+type historyRow struct {
+	When           string
+	Actor          string
+	ImpersonatedBy string
+	Entity         string
+	Changes        []historyChange
+}
+
+type historyChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+type revisionsData struct {
+	AppName    string
+	CSRFToken  string
+	Title      string
+	Error      string
+	Info       string
+	ClubName   string
+	CanRestore bool
+	Revisions  []revisionRow
+	Selected   *revisionRow
+	Changes    []revisionChangeRow
+}
+
+type revisionRow struct {
+	ID       uint
+	When     string
+	Actor    string
+	Current  bool
+	Selected bool
+}
+
+type revisionChangeRow struct {
+	Entity   string
+	Field    string
+	Revision string
+	Current  string
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/janmarkuslanger/club-portal/internal/store"
+	"github.com/janmarkuslanger/club-portal/internal/worker"
+)
+
+const (
+	workerModeStandalone = "standalone"
+	workerModeEmbedded   = "embedded"
+)
+
+// newEmbeddedWorker sets up the build loop for WORKER_MODE=embedded, so a
+// single process is enough for small deployments. It reads the same settings
+// as cmd/worker. In standalone mode it returns nil.
+func newEmbeddedWorker(mode string, storeInstance *store.Store, dataPath string) (*worker.Worker, error) {
+	switch mode {
+	case workerModeStandalone:
+		return nil, nil
+	case workerModeEmbedded:
+	default:
+		return nil, fmt.Errorf("WORKER_MODE must be %q or %q, got %q", workerModeStandalone, workerModeEmbedded, mode)
+	}
+	return worker.New(storeInstance, worker.ConfigFromEnv(dataPath))
+}
+
+// startWorker runs buildWorker in the background until ctx is done. The
+// returned channel is closed once it has stopped, or right away without a
+// worker.
+func startWorker(ctx context.Context, buildWorker *worker.Worker) <-chan struct{} {
+	done := make(chan struct{})
+	if buildWorker == nil {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		if err := buildWorker.Run(ctx); err != nil {
+			log.Printf("embedded build worker stopped: %v", err)
+		}
+	}()
+	return done
+}
@@ -4,7 +4,6 @@ go 1.24.0
 
 require (
 	github.com/janmarkuslanger/graft v0.0.2
-	github.com/janmarkuslanger/ssgo v0.7.0
 	golang.org/x/crypto v0.46.0
 	gorm.io/driver/sqlite v1.6.0
 	gorm.io/gorm v1.31.1
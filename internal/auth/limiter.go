@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// Failures before the exponential backoff kicks in, so a single typo does
+// not slow down a legitimate login.
+const backoffFreeAttempts = 2
+
+type LimiterConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Lockout     time.Duration
+	Window      time.Duration
+}
+
+type Limiter struct {
+	mu        sync.Mutex
+	cfg       LimiterConfig
+	entries   map[string]*limiterEntry
+	lastSweep time.Time
+}
+
+type limiterEntry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+func NewLimiter(cfg LimiterConfig) *Limiter {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = time.Second
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = time.Minute
+	}
+	if cfg.Lockout <= 0 {
+		cfg.Lockout = 15 * time.Minute
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = cfg.Lockout
+	}
+
+	return &Limiter{
+		cfg:     cfg,
+		entries: make(map[string]*limiterEntry),
+	}
+}
+
+func (l *Limiter) Check(key string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return 0, true
+	}
+	if now.Before(entry.blockedUntil) {
+		return entry.blockedUntil.Sub(now), false
+	}
+	return 0, true
+}
+
+func (l *Limiter) Fail(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweepLocked(now)
+
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > l.cfg.Window {
+		entry = &limiterEntry{}
+		l.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+
+	if entry.failures >= l.cfg.MaxAttempts {
+		entry.blockedUntil = now.Add(l.cfg.Lockout)
+		entry.failures = 0
+		return true
+	}
+
+	if entry.failures > backoffFreeAttempts {
+		delay := l.cfg.BaseDelay << (entry.failures - backoffFreeAttempts - 1)
+		if delay <= 0 || delay > l.cfg.MaxDelay {
+			delay = l.cfg.MaxDelay
+		}
+		entry.blockedUntil = now.Add(delay)
+	}
+	return false
+}
+
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	delete(l.entries, key)
+	l.mu.Unlock()
+}
+
+func (l *Limiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < l.cfg.Window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, entry := range l.entries {
+		if now.After(entry.blockedUntil) && now.Sub(entry.lastFailure) > l.cfg.Window {
+			delete(l.entries, key)
+		}
+	}
+}
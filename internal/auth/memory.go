@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]Session),
+	}
+}
+
+func (s *MemoryStore) SaveSession(token string, session Session) error {
+	s.mu.Lock()
+	s.sessions[token] = session
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) RefreshSession(token string, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.sessions[token]
+	if !ok || existing.UserID != session.UserID {
+		return nil
+	}
+	existing.ExpiresAt = session.ExpiresAt
+	s.sessions[token] = existing
+	return nil
+}
+
+func (s *MemoryStore) LoadSession(token string) (Session, bool, error) {
+	s.mu.RLock()
+	session, ok := s.sessions[token]
+	s.mu.RUnlock()
+	return session, ok, nil
+}
+
+func (s *MemoryStore) DeleteSession(token string) error {
+	s.mu.Lock()
+	delete(s.sessions, token)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) DeleteUserSessions(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, token)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpiredSessions(now time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var removed int64
+	for token, session := range s.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(s.sessions, token)
+			removed++
+		}
+	}
+	return removed, nil
+}
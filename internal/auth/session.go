@@ -3,62 +3,210 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"log"
 	"sync"
 	"time"
 )
 
+// Pending sessions only prove the password step of a two-factor login and
+// are never accepted by Get.
+const pendingTTL = 5 * time.Minute
+
+// Impersonation sessions are short-lived and never slide, so an operator
+// cannot stay logged in as someone else by accident.
+const impersonationTTL = time.Hour
+
 type Session struct {
 	UserID    string
 	ExpiresAt time.Time
+	Pending   bool
+
+	ImpersonatorID string
+}
+
+type SessionStore interface {
+	SaveSession(token string, session Session) error
+	RefreshSession(token string, session Session) error
+	LoadSession(token string) (Session, bool, error)
+	DeleteSession(token string) error
+	DeleteUserSessions(userID string) error
+	DeleteExpiredSessions(now time.Time) (int64, error)
 }
 
 type Manager struct {
-	mu       sync.RWMutex
-	sessions map[string]Session
-	ttl      time.Duration
+	backend SessionStore
+	ttl     time.Duration
+
+	stopOnce sync.Once
+	stop     chan struct{}
 }
 
 func NewManager(ttl time.Duration) *Manager {
+	return NewManagerWithStore(NewMemoryStore(), ttl)
+}
+
+func NewManagerWithStore(backend SessionStore, ttl time.Duration) *Manager {
 	if ttl <= 0 {
 		ttl = 24 * time.Hour
 	}
+	if backend == nil {
+		backend = NewMemoryStore()
+	}
 
 	return &Manager{
-		sessions: make(map[string]Session),
-		ttl:      ttl,
+		backend: backend,
+		ttl:     ttl,
+		stop:    make(chan struct{}),
 	}
 }
 
-func (m *Manager) Create(userID string) string {
+func (m *Manager) Create(userID string) (string, error) {
 	token := newToken()
-	m.mu.Lock()
-	m.sessions[token] = Session{
+	session := Session{
 		UserID:    userID,
-		ExpiresAt: time.Now().Add(m.ttl),
+		ExpiresAt: time.Now().UTC().Add(m.ttl),
+	}
+	if err := m.backend.SaveSession(token, session); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (m *Manager) CreatePending(userID string) (string, error) {
+	token := newToken()
+	session := Session{
+		UserID:    userID,
+		ExpiresAt: time.Now().UTC().Add(pendingTTL),
+		Pending:   true,
+	}
+	if err := m.backend.SaveSession(token, session); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (m *Manager) CreateImpersonation(userID, impersonatorID string) (string, error) {
+	ttl := m.ttl
+	if ttl > impersonationTTL {
+		ttl = impersonationTTL
+	}
+
+	token := newToken()
+	session := Session{
+		UserID:         userID,
+		ExpiresAt:      time.Now().UTC().Add(ttl),
+		ImpersonatorID: impersonatorID,
+	}
+	if err := m.backend.SaveSession(token, session); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (m *Manager) Impersonator(token string) (string, bool) {
+	session, ok := m.load(token)
+	if !ok || session.Pending || session.ImpersonatorID == "" {
+		return "", false
+	}
+	if time.Now().UTC().After(session.ExpiresAt) {
+		return "", false
 	}
-	m.mu.Unlock()
+	return session.ImpersonatorID, true
+}
 
-	return token
+func (m *Manager) GetPending(token string) (string, bool) {
+	session, ok := m.load(token)
+	if !ok || !session.Pending {
+		return "", false
+	}
+	if time.Now().UTC().After(session.ExpiresAt) {
+		m.Delete(token)
+		return "", false
+	}
+	return session.UserID, true
 }
 
 func (m *Manager) Get(token string) (string, bool) {
-	m.mu.RLock()
-	session, ok := m.sessions[token]
-	m.mu.RUnlock()
-	if !ok {
+	session, ok := m.load(token)
+	if !ok || session.Pending {
 		return "", false
 	}
-	if time.Now().After(session.ExpiresAt) {
+
+	now := time.Now().UTC()
+	if now.After(session.ExpiresAt) {
 		m.Delete(token)
 		return "", false
 	}
+
+	// Sliding expiry: only write back once half of the TTL is used up so
+	// that every request does not turn into a database write.
+	if session.ImpersonatorID == "" && session.ExpiresAt.Sub(now) < m.ttl/2 {
+		session.ExpiresAt = now.Add(m.ttl)
+		if err := m.backend.RefreshSession(token, session); err != nil {
+			log.Printf("session refresh failed: %v", err)
+		}
+	}
+
 	return session.UserID, true
 }
 
+func (m *Manager) load(token string) (Session, bool) {
+	if token == "" {
+		return Session{}, false
+	}
+
+	session, ok, err := m.backend.LoadSession(token)
+	if err != nil {
+		log.Printf("session lookup failed: %v", err)
+		return Session{}, false
+	}
+	return session, ok
+}
+
 func (m *Manager) Delete(token string) {
-	m.mu.Lock()
-	delete(m.sessions, token)
-	m.mu.Unlock()
+	if err := m.backend.DeleteSession(token); err != nil {
+		log.Printf("session delete failed: %v", err)
+	}
+}
+
+func (m *Manager) DeleteUser(userID string) error {
+	return m.backend.DeleteUserSessions(userID)
+}
+
+func (m *Manager) StartSweeper(interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				removed, err := m.backend.DeleteExpiredSessions(time.Now().UTC())
+				if err != nil {
+					log.Printf("session sweep failed: %v", err)
+					continue
+				}
+				if removed > 0 {
+					log.Printf("session sweep removed %d expired sessions", removed)
+				}
+			}
+		}
+	}()
+}
+
+func (m *Manager) Close() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
 }
 
 func newToken() string {
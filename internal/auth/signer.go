@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrTokenExpired     = errors.New("token expired")
+)
+
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+func (s *Signer) Sign(payload string, expiresAt time.Time) string {
+	body := payload + "|" + strconv.FormatInt(expiresAt.Unix(), 10)
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(body))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded))
+}
+
+func (s *Signer) Verify(token string, now time.Time) (string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, s.mac(encoded)) {
+		return "", ErrInvalidSignature
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	body := string(raw)
+	cut := strings.LastIndex(body, "|")
+	if cut < 0 {
+		return "", ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(body[cut+1:], 10, 64)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if now.After(time.Unix(expires, 0)) {
+		return "", ErrTokenExpired
+	}
+
+	return body[:cut], nil
+}
+
+func (s *Signer) MAC(value string) string {
+	return base64.RawURLEncoding.EncodeToString(s.mac(value))
+}
+
+func (s *Signer) mac(value string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(value))
+	return h.Sum(nil)
+}
@@ -0,0 +1,105 @@
+// Package buildnotify wakes the build worker when the server queues a build.
+// Notifications travel as datagrams over a local unix socket and carry no
+// data: the queue in the database stays the source of truth, and the worker
+// still polls in case a notification gets lost.
+package buildnotify
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const sendTimeout = 100 * time.Millisecond
+
+// SocketPath is the default socket location next to the database, so server
+// and worker agree on it without extra configuration.
+func SocketPath(dataPath string) string {
+	return filepath.Join(filepath.Dir(dataPath), "worker.sock")
+}
+
+// Send wakes the worker listening on path. It fails when no worker listens,
+// which callers can ignore: the worker picks the task up on its next poll.
+func Send(path string) error {
+	conn, err := net.DialTimeout("unixgram", path, sendTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(sendTimeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write([]byte{1})
+	return err
+}
+
+type Listener struct {
+	conn      *net.UnixConn
+	path      string
+	file      os.FileInfo
+	wake      chan struct{}
+	closeOnce sync.Once
+}
+
+// Listen binds the socket at path. A socket file left behind by a crashed
+// worker is replaced.
+func Listen(path string) (*Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Stat(path)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	l := &Listener{
+		conn: conn,
+		path: path,
+		file: file,
+		wake: make(chan struct{}, 1),
+	}
+	go l.read()
+	return l, nil
+}
+
+// C delivers a value after one or more notifications. Notifications that
+// arrive before the previous one was received are merged.
+func (l *Listener) C() <-chan struct{} {
+	return l.wake
+}
+
+func (l *Listener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		err = l.conn.Close()
+		// Another worker may have taken over the path in the meantime.
+		if current, statErr := os.Stat(l.path); statErr == nil && os.SameFile(current, l.file) {
+			os.Remove(l.path)
+		}
+	})
+	return err
+}
+
+func (l *Listener) read() {
+	buf := make([]byte, 16)
+	for {
+		if _, _, err := l.conn.ReadFromUnix(buf); err != nil {
+			return
+		}
+		select {
+		case l.wake <- struct{}{}:
+		default:
+		}
+	}
+}
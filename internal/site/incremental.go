@@ -0,0 +1,308 @@
+package site
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+// The manifest lives next to the generated pages and records what each of
+// them was rendered from, so an incremental build can skip unchanged work.
+const manifestName = ".build-manifest.json"
+
+type buildManifest struct {
+	Clubs  map[string]manifestClub `json:"clubs"`
+	Assets map[string]string       `json:"assets"`
+}
+
+// manifestClub is keyed by club ID in the manifest, so a page can be removed
+// or moved even when only the ID of a changed club is known.
+type manifestClub struct {
+	Slug string `json:"slug"`
+	Hash string `json:"hash"`
+}
+
+// buildSite renders every club and copies every asset that changed since
+// previous into the output and removes pages of clubs that are gone.
+func buildSite(ctx context.Context, clubs []store.Club, previous buildManifest, opts BuildOptions) (BuildReport, error) {
+	current, err := newManifest(opts)
+	if err != nil {
+		return BuildReport{}, err
+	}
+
+	report, err := renderClubs(ctx, clubs, previous, current, opts)
+	if err != nil {
+		return report, err
+	}
+
+	if report.AssetsCopied, err = copyAssets(previous, current, opts); err != nil {
+		return report, err
+	}
+
+	removed, err := pruneClubPages(opts.OutputDir, current.slugs())
+	if err != nil {
+		return report, err
+	}
+	report.Removed += removed
+
+	return report, saveManifest(opts.OutputDir, current)
+}
+
+// BuildClubs updates only the pages of the given clubs. clubs holds the public
+// state of those IDs; an ID without a club has its page removed. Assets and
+// all other pages are left alone.
+func BuildClubs(ctx context.Context, clubIDs []string, clubs []store.Club, opts BuildOptions) (BuildReport, error) {
+	opts = opts.withDefaults()
+	return inRelease(ctx, opts, true, func(staged BuildOptions) (BuildReport, error) {
+		return buildClubs(ctx, clubIDs, clubs, staged)
+	})
+}
+
+func buildClubs(ctx context.Context, clubIDs []string, clubs []store.Club, opts BuildOptions) (BuildReport, error) {
+	previous := loadManifest(opts.OutputDir)
+	current := buildManifest{
+		Clubs:  make(map[string]manifestClub, len(previous.Clubs)),
+		Assets: previous.Assets,
+	}
+	for id, entry := range previous.Clubs {
+		current.Clubs[id] = entry
+	}
+	for _, id := range clubIDs {
+		delete(current.Clubs, id)
+	}
+
+	report, err := renderClubs(ctx, clubs, previous, current, opts)
+	if err != nil {
+		return report, err
+	}
+
+	for _, id := range clubIDs {
+		entry, ok := previous.Clubs[id]
+		if !ok {
+			continue
+		}
+		if next, ok := current.Clubs[id]; ok && next.Slug == entry.Slug {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(opts.OutputDir, "clubs", entry.Slug)); err != nil {
+			return report, err
+		}
+		report.Removed++
+	}
+
+	return report, saveManifest(opts.OutputDir, current)
+}
+
+// renderClubs renders every club whose page changed since previous and adds
+// all of them to current.
+func renderClubs(ctx context.Context, clubs []store.Club, previous, current buildManifest, opts BuildOptions) (BuildReport, error) {
+	var report BuildReport
+
+	templates, err := templatesHash(opts.TemplateDir)
+	if err != nil {
+		return report, err
+	}
+
+	renderer, err := NewRenderer(opts.TemplateDir)
+	if err != nil {
+		return report, err
+	}
+	for _, club := range clubs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		page := NewClubPage(club)
+		entry, err := manifestEntry(page, templates)
+		if err != nil {
+			return report, err
+		}
+		current.Clubs[club.ID] = entry
+
+		target := filepath.Join(opts.OutputDir, "clubs", club.Slug, "index.html")
+		if opts.Incremental && previous.Clubs[club.ID] == entry && fileExists(target) {
+			report.Skipped++
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := renderer.RenderPage(&buf, page); err != nil {
+			return report, err
+		}
+		if err := writeFile(target, buf.Bytes()); err != nil {
+			return report, err
+		}
+		report.Rendered++
+	}
+	return report, nil
+}
+
+// manifestEntry hashes the page together with the templates, which keeps
+// pages that a per-club build skipped marked as stale after a template change.
+func manifestEntry(page ClubPage, templates string) (manifestClub, error) {
+	encoded, err := json.Marshal(page)
+	if err != nil {
+		return manifestClub{}, err
+	}
+	sum := sha256.Sum256(append([]byte(templates), encoded...))
+	return manifestClub{Slug: page.Slug, Hash: hex.EncodeToString(sum[:])}, nil
+}
+
+func copyAssets(previous, current buildManifest, opts BuildOptions) (int, error) {
+	assetsDir := filepath.Join(opts.OutputDir, "assets")
+	copied := 0
+	for rel, sum := range current.Assets {
+		target := filepath.Join(assetsDir, rel)
+		if previous.Assets[rel] == sum && fileExists(target) {
+			continue
+		}
+		if err := copyFile(filepath.Join(opts.AssetDir, rel), target); err != nil {
+			return copied, err
+		}
+		copied++
+	}
+	for rel := range previous.Assets {
+		if _, ok := current.Assets[rel]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(assetsDir, rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
+
+// newManifest starts a manifest for a full build: no clubs yet and the
+// current hashes of all assets.
+func newManifest(opts BuildOptions) (buildManifest, error) {
+	manifest := buildManifest{
+		Clubs:  make(map[string]manifestClub),
+		Assets: make(map[string]string),
+	}
+
+	err := filepath.WalkDir(opts.AssetDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		sum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(opts.AssetDir, path)
+		if err != nil {
+			return err
+		}
+		manifest.Assets[filepath.ToSlash(rel)] = sum
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return buildManifest{}, err
+	}
+	return manifest, nil
+}
+
+func (m buildManifest) slugs() map[string]bool {
+	slugs := make(map[string]bool, len(m.Clubs))
+	for _, entry := range m.Clubs {
+		slugs[entry.Slug] = true
+	}
+	return slugs
+}
+
+func templatesHash(templateDir string) (string, error) {
+	hash := sha256.New()
+	for _, name := range []string{"layout.html", "club.html"} {
+		content, err := os.ReadFile(filepath.Join(templateDir, name))
+		if err != nil {
+			return "", err
+		}
+		hash.Write(content)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// loadManifest treats a missing or unreadable manifest as empty, which turns
+// the next build into a full one.
+func loadManifest(outputDir string) buildManifest {
+	var manifest buildManifest
+	content, err := os.ReadFile(filepath.Join(outputDir, manifestName))
+	if err != nil {
+		return manifest
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return buildManifest{}
+	}
+	return manifest
+}
+
+func saveManifest(outputDir string, manifest buildManifest) error {
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(outputDir, manifestName), encoded)
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func copyFile(source, target string) error {
+	content, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	return writeFile(target, content)
+}
+
+// writeFile replaces path instead of writing into it, because a staged
+// release shares its unchanged files with the live one via hard links.
+func writeFile(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
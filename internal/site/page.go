@@ -0,0 +1,235 @@
+package site
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/janmarkuslanger/club-portal/internal/i18n"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+// ClubPage is everything templates/site/club.html renders for one club.
+type ClubPage struct {
+	AppName     string
+	Name        string
+	Description string
+	Slug        string
+
+	ContactName    string
+	ContactRole    string
+	ContactEmail   string
+	ContactPhone   string
+	ContactWebsite string
+	AddressLine1   string
+	AddressLine2   string
+	AddressPostal  string
+	AddressCity    string
+	AddressCountry string
+
+	OpeningHours    []OpeningHourView
+	HasOpeningHours bool
+	Schedule        []ScheduleDay
+	HasSchedule     bool
+	HasContact      bool
+	HasAddress      bool
+}
+
+type OpeningHourView struct {
+	Day   string
+	Open  string
+	Close string
+	Note  string
+}
+
+type CourseView struct {
+	Title       string
+	Start       string
+	End         string
+	Location    string
+	Instructor  string
+	Level       string
+	Description string
+}
+
+type ScheduleSlot struct {
+	Time    string
+	Courses []CourseView
+}
+
+type ScheduleDay struct {
+	Day   string
+	Slots []ScheduleSlot
+}
+
+func NewClubPage(club store.Club) ClubPage {
+	openingHours, hasOpeningHours := buildOpeningHours(club.OpeningHours)
+	schedule, hasSchedule := buildSchedule(club.Courses)
+
+	return ClubPage{
+		AppName:         i18n.AppName(),
+		Name:            club.Name,
+		Description:     club.Description,
+		Slug:            club.Slug,
+		ContactName:     club.ContactName,
+		ContactRole:     club.ContactRole,
+		ContactEmail:    club.ContactEmail,
+		ContactPhone:    club.ContactPhone,
+		ContactWebsite:  club.ContactWebsite,
+		AddressLine1:    club.AddressLine1,
+		AddressLine2:    club.AddressLine2,
+		AddressPostal:   club.AddressPostal,
+		AddressCity:     club.AddressCity,
+		AddressCountry:  club.AddressCountry,
+		OpeningHours:    openingHours,
+		HasOpeningHours: hasOpeningHours,
+		Schedule:        schedule,
+		HasSchedule:     hasSchedule,
+		HasContact:      club.ContactName != "" || club.ContactRole != "" || club.ContactEmail != "" || club.ContactPhone != "" || club.ContactWebsite != "",
+		HasAddress:      club.AddressLine1 != "" || club.AddressLine2 != "" || club.AddressPostal != "" || club.AddressCity != "" || club.AddressCountry != "",
+	}
+}
+
+func buildOpeningHours(hours []store.OpeningHour) ([]OpeningHourView, bool) {
+	byDay := make(map[int]store.OpeningHour, len(hours))
+	for _, hour := range hours {
+		if hour.DayOfWeek < 1 || hour.DayOfWeek > 7 {
+			continue
+		}
+		if _, exists := byDay[hour.DayOfWeek]; !exists {
+			byDay[hour.DayOfWeek] = hour
+		}
+	}
+
+	result := make([]OpeningHourView, 0, 7)
+	hasAny := false
+	for day := 1; day <= 7; day++ {
+		hour := byDay[day]
+		open := strings.TrimSpace(hour.OpensAt)
+		close := strings.TrimSpace(hour.ClosesAt)
+		note := strings.TrimSpace(hour.Note)
+		if open != "" || close != "" || note != "" {
+			hasAny = true
+		}
+		result = append(result, OpeningHourView{
+			Day:   weekdayLabel(day),
+			Open:  open,
+			Close: close,
+			Note:  note,
+		})
+	}
+
+	return result, hasAny
+}
+
+func buildSchedule(courses []store.Course) ([]ScheduleDay, bool) {
+	if len(courses) == 0 {
+		return nil, false
+	}
+
+	courses = append([]store.Course(nil), courses...)
+	sort.Slice(courses, func(i, j int) bool {
+		if courses[i].DayOfWeek != courses[j].DayOfWeek {
+			return courses[i].DayOfWeek < courses[j].DayOfWeek
+		}
+		startI := timeKey(courses[i].StartTime)
+		startJ := timeKey(courses[j].StartTime)
+		if startI != startJ {
+			return startI < startJ
+		}
+		endI := timeKey(courses[i].EndTime)
+		endJ := timeKey(courses[j].EndTime)
+		if endI != endJ {
+			return endI < endJ
+		}
+		return courses[i].Title < courses[j].Title
+	})
+
+	schedule := make([]ScheduleDay, 0)
+	var currentDay *ScheduleDay
+	var currentSlot *ScheduleSlot
+	var currentDayValue int
+	var currentSlotKey string
+
+	for _, course := range courses {
+		if course.DayOfWeek < 1 || course.DayOfWeek > 7 {
+			continue
+		}
+		slotKey := timeKey(course.StartTime) + "|" + timeKey(course.EndTime)
+		if currentDay == nil || currentDayValue != course.DayOfWeek {
+			schedule = append(schedule, ScheduleDay{
+				Day: weekdayLabel(course.DayOfWeek),
+			})
+			currentDay = &schedule[len(schedule)-1]
+			currentSlot = nil
+			currentDayValue = course.DayOfWeek
+			currentSlotKey = ""
+		}
+
+		if currentSlot == nil || currentSlotKey != slotKey {
+			currentDay.Slots = append(currentDay.Slots, ScheduleSlot{
+				Time: formatTimeRange(course.StartTime, course.EndTime),
+			})
+			currentSlot = &currentDay.Slots[len(currentDay.Slots)-1]
+			currentSlotKey = slotKey
+		}
+
+		currentSlot.Courses = append(currentSlot.Courses, CourseView{
+			Title:       course.Title,
+			Start:       course.StartTime,
+			End:         course.EndTime,
+			Location:    course.Location,
+			Instructor:  course.Instructor,
+			Level:       course.Level,
+			Description: course.Description,
+		})
+	}
+
+	if len(schedule) == 0 {
+		return nil, false
+	}
+	return schedule, true
+}
+
+func weekdayLabel(day int) string {
+	switch day {
+	case 1:
+		return "Montag"
+	case 2:
+		return "Dienstag"
+	case 3:
+		return "Mittwoch"
+	case 4:
+		return "Donnerstag"
+	case 5:
+		return "Freitag"
+	case 6:
+		return "Samstag"
+	case 7:
+		return "Sonntag"
+	default:
+		return ""
+	}
+}
+
+func timeKey(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) == 4 && strings.Contains(value, ":") {
+		return "0" + value
+	}
+	return value
+}
+
+func formatTimeRange(start, end string) string {
+	start = strings.TrimSpace(start)
+	end = strings.TrimSpace(end)
+	if start != "" && end != "" {
+		return start + " - " + end
+	}
+	if start != "" {
+		return start
+	}
+	if end != "" {
+		return end
+	}
+	return "nach Vereinbarung"
+}
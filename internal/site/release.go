@@ -0,0 +1,246 @@
+package site
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OutputDir is a symlink to one of the release directories kept next to it in
+// OutputDir+releasesSuffix. A build renders into a fresh release and the
+// symlink is swapped only after the release passed validation, so visitors
+// never see a half-written tree.
+const (
+	releasesSuffix    = ".releases"
+	releaseTimeLayout = "20060102T150405.000000000Z"
+)
+
+// DefaultKeepReleases is used when BuildOptions.KeepReleases is not set.
+const DefaultKeepReleases = 5
+
+var ErrNoPreviousRelease = errors.New("no previous release to roll back to")
+
+// inRelease runs build against a staged copy of the output. With seed, the
+// live release is hard-linked into the stage first, so incremental builds
+// can keep unchanged files; writeFile replaces files instead of editing them
+// in place, which leaves the live release untouched. A build cancelled
+// through ctx is discarded like a failed one.
+func inRelease(ctx context.Context, opts BuildOptions, seed bool, build func(BuildOptions) (BuildReport, error)) (BuildReport, error) {
+	releasesDir := opts.OutputDir + releasesSuffix
+	if err := os.MkdirAll(releasesDir, 0o755); err != nil {
+		return BuildReport{}, err
+	}
+
+	stage, err := os.MkdirTemp(releasesDir, ".stage-")
+	if err != nil {
+		return BuildReport{}, err
+	}
+	keepStage := false
+	defer func() {
+		if !keepStage {
+			os.RemoveAll(stage)
+		}
+	}()
+	// MkdirTemp creates the directory private to the worker; the release has
+	// to be readable by whatever serves it.
+	if err := os.Chmod(stage, 0o755); err != nil {
+		return BuildReport{}, err
+	}
+
+	if seed {
+		if err := linkTree(opts.OutputDir, stage); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return BuildReport{}, err
+		}
+	}
+
+	staged := opts
+	staged.OutputDir = stage
+	report, err := build(staged)
+	if err != nil {
+		return report, err
+	}
+	if err := validateRelease(stage); err != nil {
+		return report, fmt.Errorf("release rejected: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	if opts.BeforeActivate != nil {
+		if err := opts.BeforeActivate(); err != nil {
+			return report, fmt.Errorf("release not activated: %w", err)
+		}
+	}
+
+	release := filepath.Join(releasesDir, time.Now().UTC().Format(releaseTimeLayout))
+	if err := os.Rename(stage, release); err != nil {
+		return report, err
+	}
+	keepStage = true
+	if err := activate(opts.OutputDir, release); err != nil {
+		return report, err
+	}
+	return report, pruneReleases(opts.OutputDir, opts.KeepReleases)
+}
+
+// validateRelease checks that every page and asset the manifest promises is
+// present and not empty.
+func validateRelease(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, manifestName)); err != nil {
+		return err
+	}
+	manifest := loadManifest(dir)
+	for _, entry := range manifest.Clubs {
+		if err := nonEmptyFile(filepath.Join(dir, "clubs", entry.Slug, "index.html")); err != nil {
+			return err
+		}
+	}
+	for rel := range manifest.Assets {
+		if _, err := os.Stat(filepath.Join(dir, "assets", filepath.FromSlash(rel))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Releases lists the kept releases of outputDir, newest first, and the name
+// of the one that is currently served.
+func Releases(outputDir string) ([]string, string, error) {
+	entries, err := os.ReadDir(outputDir + releasesSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	current := ""
+	if target, err := os.Readlink(outputDir); err == nil {
+		current = filepath.Base(target)
+	}
+	return names, current, nil
+}
+
+// Rollback serves the release built before the current one again.
+func Rollback(outputDir string) (string, error) {
+	names, current, err := Releases(outputDir)
+	if err != nil {
+		return "", err
+	}
+	for i, name := range names {
+		if name == current && i+1 < len(names) {
+			previous := names[i+1]
+			return previous, activate(outputDir, filepath.Join(outputDir+releasesSuffix, previous))
+		}
+	}
+	return "", ErrNoPreviousRelease
+}
+
+// activate points outputDir at release by renaming a new symlink over the
+// old one, which is atomic. A plain directory left from before releases is
+// moved aside as a release of its own.
+func activate(outputDir, release string) error {
+	info, err := os.Lstat(outputDir)
+	switch {
+	case err == nil && info.IsDir():
+		legacy := filepath.Join(outputDir+releasesSuffix, info.ModTime().UTC().Format(releaseTimeLayout))
+		if err := os.Rename(outputDir, legacy); err != nil {
+			return err
+		}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+
+	target, err := filepath.Rel(filepath.Dir(outputDir), release)
+	if err != nil {
+		return err
+	}
+	// With a fixed name, two builders could replace each other's link
+	// between Symlink and Rename; CreateTemp reserves a unique one.
+	placeholder, err := os.CreateTemp(filepath.Dir(outputDir), "."+filepath.Base(outputDir)+".next-")
+	if err != nil {
+		return err
+	}
+	link := placeholder.Name()
+	placeholder.Close()
+	if err := os.Remove(link); err != nil {
+		return err
+	}
+	if err := os.Symlink(target, link); err != nil {
+		return err
+	}
+	if err := os.Rename(link, outputDir); err != nil {
+		os.Remove(link)
+		return err
+	}
+	return nil
+}
+
+func pruneReleases(outputDir string, keep int) error {
+	if keep <= 0 {
+		keep = DefaultKeepReleases
+	}
+	names, current, err := Releases(outputDir)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		if i < keep || name == current {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(outputDir+releasesSuffix, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkTree recreates the tree below source in target with hard links.
+func linkTree(source, target string) error {
+	root, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(target, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(dest, 0o755)
+		}
+		if err := os.Link(path, dest); err != nil {
+			return copyFile(path, dest)
+		}
+		return nil
+	})
+}
+
+func nonEmptyFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("%s is empty", path)
+	}
+	return nil
+}
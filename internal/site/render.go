@@ -0,0 +1,56 @@
+package site
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"path/filepath"
+
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+// Renderer renders club pages from layout.html and club.html. The templates
+// are parsed once, when the Renderer is created.
+type Renderer struct {
+	tmpl *template.Template
+}
+
+// NewRenderer parses the templates in templateDir, templates/site when empty.
+func NewRenderer(templateDir string) (*Renderer, error) {
+	if templateDir == "" {
+		templateDir = filepath.Join("templates", "site")
+	}
+
+	// layout.html defines "root", which includes the blocks of club.html.
+	tmpl, err := template.New("root").ParseFiles(
+		filepath.Join(templateDir, "layout.html"),
+		filepath.Join(templateDir, "club.html"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Renderer{tmpl: tmpl}, nil
+}
+
+// RenderClub renders a club with the default templates.
+func RenderClub(w io.Writer, club store.Club) error {
+	renderer, err := NewRenderer("")
+	if err != nil {
+		return err
+	}
+	return renderer.RenderClub(w, club)
+}
+
+func (r *Renderer) RenderClub(w io.Writer, club store.Club) error {
+	return r.RenderPage(w, NewClubPage(club))
+}
+
+func (r *Renderer) RenderPage(w io.Writer, page ClubPage) error {
+	// Render into a buffer so a template error does not leave a half-written page.
+	var buf bytes.Buffer
+	if err := r.tmpl.Execute(&buf, page); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func (s *Store) ChangePassword(userID, currentPassword, newPassword string) error {
+	var user User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		return ErrInvalidCredentials
+	}
+	if err := s.validatePassword(user.Email, newPassword); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userID).
+			Update("password_hash", string(hash)).Error; err != nil {
+			return err
+		}
+		return expireResetTokens(tx, userID, time.Now().UTC())
+	})
+}
+
+// ChangeEmail switches the login address and clears verified_at, so the new
+// address has to be confirmed before the account regains full access.
+func (s *Store) ChangeEmail(userID, password, newEmail string) (User, error) {
+	cleanEmail := normalizeEmail(newEmail)
+	if cleanEmail == "" {
+		return User{}, ErrEmailRequired
+	}
+
+	var user User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return User{}, ErrUserNotFound
+		}
+		return User{}, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+	if cleanEmail == user.Email {
+		return User{}, ErrEmailUnchanged
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var existing User
+		err := tx.Select("id").Where("email = ?", cleanEmail).First(&existing).Error
+		if err == nil {
+			return ErrEmailExists
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]any{
+			"email":       cleanEmail,
+			"verified_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		// Reset links were mailed to the old address and must not outlive it.
+		if err := expireResetTokens(tx, userID, time.Now().UTC()); err != nil {
+			return err
+		}
+		return tx.First(&user, "id = ?", userID).Error
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func expireResetTokens(tx *gorm.DB, userID string, now time.Time) error {
+	return tx.Model(&PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", now).Error
+}
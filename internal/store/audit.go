@@ -0,0 +1,200 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AuditEntityClub         = "club"
+	AuditEntityOpeningHours = "opening_hours"
+	AuditEntityCourses      = "courses"
+)
+
+type AuditEvent struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	ClubID         string    `json:"club_id" gorm:"index;size:32;not null"`
+	ActorID        string    `json:"actor_id" gorm:"index;size:32;not null"`
+	ImpersonatorID string    `json:"impersonator_id,omitempty" gorm:"index;size:32"`
+	Entity         string    `json:"entity" gorm:"size:20;not null"`
+	Changes        string    `json:"changes" gorm:"type:text;not null"`
+	CreatedAt      time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+// Actor is who made a change. ImpersonatorID is set when a platform admin
+// made it while signed in as UserID.
+type Actor struct {
+	UserID         string
+	ImpersonatorID string
+}
+
+// FieldChange is one entry of an audit diff. Field is the column name for
+// club events, "<day>.<column>" for opening hours and "<title>.<column>" for
+// courses, with " #n" appended to repeated course titles.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+type AuditEntry struct {
+	ID         uint
+	Entity     string
+	ActorEmail string
+	// ImpersonatorEmail is set when a platform admin made the change.
+	ImpersonatorEmail string
+	CreatedAt         time.Time
+	Changes           []FieldChange
+}
+
+type auditField struct {
+	Key   string
+	Value string
+}
+
+func (s *Store) ClubHistory(clubID string, limit int) ([]AuditEntry, error) {
+	var rows []struct {
+		AuditEvent
+		ActorEmail        string
+		ImpersonatorEmail string
+	}
+	err := s.db.Table("audit_events").
+		Select("audit_events.*, COALESCE(users.email, audit_events.actor_id) AS actor_email, "+
+			"COALESCE(impersonators.email, audit_events.impersonator_id, '') AS impersonator_email").
+		Joins("LEFT JOIN users ON users.id = audit_events.actor_id").
+		Joins("LEFT JOIN users AS impersonators ON impersonators.id = audit_events.impersonator_id").
+		Where("audit_events.club_id = ?", clubID).
+		Order("audit_events.created_at desc").Order("audit_events.id desc").
+		Limit(limit).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(rows))
+	for _, row := range rows {
+		entry := AuditEntry{
+			ID:                row.ID,
+			Entity:            row.Entity,
+			ActorEmail:        row.ActorEmail,
+			ImpersonatorEmail: row.ImpersonatorEmail,
+			CreatedAt:         row.CreatedAt,
+		}
+		if err := json.Unmarshal([]byte(row.Changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func recordAuditEvent(tx *gorm.DB, clubID string, actor Actor, entity string, changes []FieldChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&AuditEvent{
+		ClubID:         clubID,
+		ActorID:        actor.UserID,
+		ImpersonatorID: actor.ImpersonatorID,
+		Entity:         entity,
+		Changes:        string(encoded),
+		CreatedAt:      time.Now().UTC(),
+	}).Error
+}
+
+func diffFields(before, after []auditField) []FieldChange {
+	old := make(map[string]string, len(before))
+	for _, field := range before {
+		old[field.Key] = field.Value
+	}
+
+	var changes []FieldChange
+	seen := make(map[string]bool, len(after))
+	for _, field := range after {
+		seen[field.Key] = true
+		if old[field.Key] != field.Value {
+			changes = append(changes, FieldChange{Field: field.Key, Old: old[field.Key], New: field.Value})
+		}
+	}
+	for _, field := range before {
+		if !seen[field.Key] && field.Value != "" {
+			changes = append(changes, FieldChange{Field: field.Key, Old: field.Value})
+		}
+	}
+	return changes
+}
+
+func clubAuditFields(club Club) []auditField {
+	return []auditField{
+		{"name", club.Name},
+		{"slug", club.Slug},
+		{"description", club.Description},
+		{"categories", club.Categories},
+		{"contact_name", club.ContactName},
+		{"contact_role", club.ContactRole},
+		{"contact_email", club.ContactEmail},
+		{"contact_phone", club.ContactPhone},
+		{"contact_website", club.ContactWebsite},
+		{"address_line_1", club.AddressLine1},
+		{"address_line_2", club.AddressLine2},
+		{"address_postal", club.AddressPostal},
+		{"address_city", club.AddressCity},
+		{"address_country", club.AddressCountry},
+	}
+}
+
+func openingHourAuditFields(hours []OpeningHour) []auditField {
+	fields := make([]auditField, 0, len(hours)*3)
+	for _, hour := range hours {
+		prefix := strconv.Itoa(hour.DayOfWeek) + "."
+		fields = append(fields,
+			auditField{prefix + "opens_at", hour.OpensAt},
+			auditField{prefix + "closes_at", hour.ClosesAt},
+			auditField{prefix + "note", hour.Note},
+		)
+	}
+	return fields
+}
+
+func courseAuditFields(courses []Course) []auditField {
+	// Sort a copy so repeated titles get the same " #n" suffix no matter in
+	// which order the form submitted them.
+	courses = append([]Course(nil), courses...)
+	sort.SliceStable(courses, func(i, j int) bool {
+		if courses[i].Title != courses[j].Title {
+			return courses[i].Title < courses[j].Title
+		}
+		if courses[i].DayOfWeek != courses[j].DayOfWeek {
+			return courses[i].DayOfWeek < courses[j].DayOfWeek
+		}
+		return courses[i].StartTime < courses[j].StartTime
+	})
+
+	fields := make([]auditField, 0, len(courses)*7)
+	occurrences := make(map[string]int, len(courses))
+	for _, course := range courses {
+		occurrences[course.Title]++
+		prefix := course.Title
+		if n := occurrences[course.Title]; n > 1 {
+			prefix += " #" + strconv.Itoa(n)
+		}
+		prefix += "."
+		fields = append(fields,
+			auditField{prefix + "day_of_week", strconv.Itoa(course.DayOfWeek)},
+			auditField{prefix + "start_time", course.StartTime},
+			auditField{prefix + "end_time", course.EndTime},
+			auditField{prefix + "location", course.Location},
+			auditField{prefix + "instructor", course.Instructor},
+			auditField{prefix + "level", course.Level},
+			auditField{prefix + "description", course.Description},
+		)
+	}
+	return fields
+}
@@ -0,0 +1,39 @@
+package store
+
+import "testing"
+
+func TestClubHistoryRecordsImpersonator(t *testing.T) {
+	s := newTestStore(t)
+
+	owner, err := s.CreateUser("vorstand@example.org", "Turnhalle-Sonntag-42")
+	if err != nil {
+		t.Fatalf("CreateUser(owner): %v", err)
+	}
+	operator, err := s.CreateUser("betrieb@example.org", "Leitstelle-Nord-1977")
+	if err != nil {
+		t.Fatalf("CreateUser(operator): %v", err)
+	}
+
+	club, err := s.UpsertClub(Actor{UserID: owner.ID}, ClubUpdate{Name: "TSV Beispiel"})
+	if err != nil {
+		t.Fatalf("UpsertClub(owner): %v", err)
+	}
+	impersonated := Actor{UserID: owner.ID, ImpersonatorID: operator.ID}
+	if _, err := s.UpsertClub(impersonated, ClubUpdate{Name: "TSV Beispiel", Description: "Breitensport"}); err != nil {
+		t.Fatalf("UpsertClub(impersonated): %v", err)
+	}
+
+	entries, err := s.ClubHistory(club.ID, 10)
+	if err != nil {
+		t.Fatalf("ClubHistory: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("ClubHistory returned %d entries, want 2", len(entries))
+	}
+	if latest := entries[0]; latest.ActorEmail != owner.Email || latest.ImpersonatorEmail != operator.Email {
+		t.Errorf("impersonated change: actor=%q impersonator=%q", latest.ActorEmail, latest.ImpersonatorEmail)
+	}
+	if first := entries[1]; first.ActorEmail != owner.Email || first.ImpersonatorEmail != "" {
+		t.Errorf("own change: actor=%q impersonator=%q", first.ActorEmail, first.ImpersonatorEmail)
+	}
+}
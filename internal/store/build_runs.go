@@ -0,0 +1,162 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	BuildRunRunning   = "running"
+	BuildRunSucceeded = "succeeded"
+	BuildRunFailed    = "failed"
+
+	BuildScopeSite  = "site"
+	BuildScopeClubs = "clubs"
+)
+
+// BuildRun is one execution of the worker. ClubIDs lists the clubs of a
+// per-club build; a site build covers every club and leaves it empty.
+type BuildRun struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Scope      string     `json:"scope" gorm:"size:10;not null"`
+	WorkerID   string     `json:"worker_id" gorm:"size:100;index"`
+	ClubIDs    string     `json:"club_ids" gorm:"type:text"`
+	Status     string     `json:"status" gorm:"size:20;not null;index"`
+	ClubCount  int        `json:"club_count"`
+	Rendered   int        `json:"rendered"`
+	Skipped    int        `json:"skipped"`
+	Removed    int        `json:"removed"`
+	Error      string     `json:"error" gorm:"type:text"`
+	StartedAt  time.Time  `json:"started_at" gorm:"index"`
+	FinishedAt *time.Time `json:"finished_at"`
+	DurationMs int64      `json:"duration_ms"`
+}
+
+type BuildRunResult struct {
+	ClubCount int
+	Rendered  int
+	Skipped   int
+	Removed   int
+}
+
+// ClubBuildStatus tells a club admin whether their last publication is live.
+type ClubBuildStatus struct {
+	// Scheduled is set while a build for the club, or one of the whole site,
+	// is queued or running.
+	Scheduled bool
+	NextRunAt time.Time
+	Running   bool
+
+	LastSuccess *BuildRun
+	// LastFailure is only set when it happened after LastSuccess.
+	LastFailure *BuildRun
+	Recent      []BuildRun
+}
+
+func (s *Store) StartBuildRun(workerID, scope string, clubIDs []string) (BuildRun, error) {
+	run := BuildRun{
+		Scope:     scope,
+		WorkerID:  workerID,
+		ClubIDs:   strings.Join(clubIDs, ","),
+		Status:    BuildRunRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	if err := s.db.Create(&run).Error; err != nil {
+		return BuildRun{}, err
+	}
+	return run, nil
+}
+
+func (s *Store) FinishBuildRun(runID uint, result BuildRunResult, buildErr error) error {
+	var run BuildRun
+	if err := s.db.First(&run, runID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	run.FinishedAt = &now
+	run.DurationMs = now.Sub(run.StartedAt).Milliseconds()
+	run.ClubCount = result.ClubCount
+	run.Rendered = result.Rendered
+	run.Skipped = result.Skipped
+	run.Removed = result.Removed
+	run.Status = BuildRunSucceeded
+	if buildErr != nil {
+		run.Status = BuildRunFailed
+		run.Error = buildErr.Error()
+	}
+	return s.db.Save(&run).Error
+}
+
+func (s *Store) PruneBuildRuns(before time.Time) (int64, error) {
+	result := s.db.Where("started_at < ? AND status <> ?", before, BuildRunRunning).Delete(&BuildRun{})
+	return result.RowsAffected, result.Error
+}
+
+// RecentBuildRuns lists the latest runs of all workers, newest first.
+func (s *Store) RecentBuildRuns(limit int) ([]BuildRun, error) {
+	var runs []BuildRun
+	err := s.db.Order("started_at desc").Order("id desc").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+func (s *Store) ClubBuildStatus(clubID string, limit int) (ClubBuildStatus, error) {
+	var status ClubBuildStatus
+
+	var tasks []BuildTask
+	if err := s.db.Where("key IN ?", []string{clubBuildKeyPrefix + clubID, buildTaskKey}).
+		Find(&tasks).Error; err != nil {
+		return status, err
+	}
+	for _, task := range tasks {
+		if task.Status == buildStatusIdle {
+			continue
+		}
+		if !status.Scheduled || task.NextRunAt.Before(status.NextRunAt) {
+			status.NextRunAt = task.NextRunAt
+		}
+		status.Scheduled = true
+		status.Running = status.Running || task.Status == buildStatusRunning
+	}
+
+	if err := s.clubBuildRuns(clubID).
+		Order("started_at desc").Order("id desc").
+		Limit(limit).Find(&status.Recent).Error; err != nil {
+		return status, err
+	}
+
+	var success BuildRun
+	err := s.clubBuildRuns(clubID).Where("status = ?", BuildRunSucceeded).
+		Order("started_at desc").Order("id desc").First(&success).Error
+	switch {
+	case err == nil:
+		status.LastSuccess = &success
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return status, err
+	}
+
+	failures := s.clubBuildRuns(clubID).Where("status = ?", BuildRunFailed)
+	if status.LastSuccess != nil {
+		failures = failures.Where("started_at > ?", status.LastSuccess.StartedAt)
+	}
+	var failure BuildRun
+	err = failures.Order("started_at desc").Order("id desc").First(&failure).Error
+	switch {
+	case err == nil:
+		status.LastFailure = &failure
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return status, err
+	}
+
+	return status, nil
+}
+
+// clubBuildRuns matches whole IDs in the comma-separated ClubIDs, so one ID
+// that is part of another does not pick up its runs.
+func (s *Store) clubBuildRuns(clubID string) *gorm.DB {
+	return s.db.Model(&BuildRun{}).
+		Where("scope = ? OR ',' || club_ids || ',' LIKE ?", BuildScopeSite, "%,"+clubID+",%")
+}
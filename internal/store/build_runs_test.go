@@ -0,0 +1,64 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClubBuildStatusMatchesWholeClubIDs(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, clubIDs := range [][]string{{"abc1234"}, {"ff00", "abc123"}} {
+		run, err := s.StartBuildRun("worker-a", BuildScopeClubs, clubIDs)
+		if err != nil {
+			t.Fatalf("StartBuildRun(%v): %v", clubIDs, err)
+		}
+		if err := s.FinishBuildRun(run.ID, BuildRunResult{ClubCount: len(clubIDs)}, nil); err != nil {
+			t.Fatalf("FinishBuildRun: %v", err)
+		}
+	}
+
+	for clubID, want := range map[string]int{"abc123": 1, "abc1234": 1, "ff00": 1, "abc": 0, "234": 0} {
+		status, err := s.ClubBuildStatus(clubID, 10)
+		if err != nil {
+			t.Fatalf("ClubBuildStatus(%s): %v", clubID, err)
+		}
+		if len(status.Recent) != want {
+			t.Errorf("ClubBuildStatus(%s): %d runs, want %d", clubID, len(status.Recent), want)
+		}
+	}
+}
+
+func TestClubBuildStatusIncludesSiteBuild(t *testing.T) {
+	s := newTestStore(t)
+
+	status, err := s.ClubBuildStatus("abc123", 10)
+	if err != nil {
+		t.Fatalf("ClubBuildStatus: %v", err)
+	}
+	if status.Scheduled {
+		t.Fatal("club is scheduled without any build task")
+	}
+
+	if err := s.EnqueueBuildTask(time.Minute); err != nil {
+		t.Fatalf("EnqueueBuildTask: %v", err)
+	}
+	status, err = s.ClubBuildStatus("abc123", 10)
+	if err != nil {
+		t.Fatalf("ClubBuildStatus: %v", err)
+	}
+	if !status.Scheduled || status.Running {
+		t.Fatalf("pending site build: scheduled=%v running=%v, want scheduled only", status.Scheduled, status.Running)
+	}
+
+	if _, err := s.ClaimBuildTasks("worker-a", time.Now().UTC().Add(2*time.Minute), time.Minute, 10); err != nil {
+		t.Fatalf("ClaimBuildTasks: %v", err)
+	}
+	status, err = s.ClubBuildStatus("abc123", 10)
+	if err != nil {
+		t.Fatalf("ClubBuildStatus: %v", err)
+	}
+	if !status.Running {
+		t.Fatal("running site build does not show as running")
+	}
+}
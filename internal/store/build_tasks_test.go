@@ -0,0 +1,163 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const testLease = time.Minute
+
+func claimOne(t *testing.T, s *Store, workerID string, now time.Time) BuildTask {
+	t.Helper()
+
+	tasks, err := s.ClaimBuildTasks(workerID, now, testLease, 10)
+	if err != nil {
+		t.Fatalf("ClaimBuildTasks(%s): %v", workerID, err)
+	}
+	if len(tasks) != 1 {
+		t.Fatalf("ClaimBuildTasks(%s): claimed %d tasks, want 1", workerID, len(tasks))
+	}
+	return tasks[0]
+}
+
+func loadBuildTask(t *testing.T, s *Store, id uint) BuildTask {
+	t.Helper()
+
+	var task BuildTask
+	if err := s.db.First(&task, id).Error; err != nil {
+		t.Fatalf("load build task %d: %v", id, err)
+	}
+	return task
+}
+
+func TestClaimBuildTasksHonoursLease(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.EnqueueClubBuildTask("club-1", 0); err != nil {
+		t.Fatalf("EnqueueClubBuildTask: %v", err)
+	}
+
+	now := time.Now().UTC()
+	task := claimOne(t, s, "worker-a", now)
+
+	tasks, err := s.ClaimBuildTasks("worker-b", now.Add(testLease/2), testLease, 10)
+	if err != nil {
+		t.Fatalf("ClaimBuildTasks(worker-b): %v", err)
+	}
+	if len(tasks) != 0 {
+		t.Fatalf("worker-b claimed %d tasks while worker-a holds the lease", len(tasks))
+	}
+
+	if err := s.RenewBuildLeases("worker-a", []uint{task.ID}, testLease); err != nil {
+		t.Fatalf("RenewBuildLeases(worker-a): %v", err)
+	}
+}
+
+func TestExpiredLeaseIsLostToNextClaimer(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.EnqueueClubBuildTask("club-1", 0); err != nil {
+		t.Fatalf("EnqueueClubBuildTask: %v", err)
+	}
+
+	now := time.Now().UTC()
+	task := claimOne(t, s, "worker-a", now)
+	stolen := claimOne(t, s, "worker-b", now.Add(2*testLease))
+	if stolen.ID != task.ID {
+		t.Fatalf("worker-b claimed task %d, want %d", stolen.ID, task.ID)
+	}
+
+	if err := s.RenewBuildLeases("worker-a", []uint{task.ID}, testLease); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("RenewBuildLeases(worker-a) = %v, want ErrLeaseLost", err)
+	}
+	if err := s.CompleteBuildTask("worker-a", task.ID); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("CompleteBuildTask(worker-a) = %v, want ErrLeaseLost", err)
+	}
+	if err := s.RescheduleBuildTask("worker-a", task.ID, 0); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("RescheduleBuildTask(worker-a) = %v, want ErrLeaseLost", err)
+	}
+
+	// worker-a's late calls must not have touched worker-b's claim.
+	current := loadBuildTask(t, s, task.ID)
+	if current.Status != buildStatusRunning || current.ClaimedBy != "worker-b" {
+		t.Fatalf("task after worker-a gave up: status=%s claimed_by=%s", current.Status, current.ClaimedBy)
+	}
+	if err := s.CompleteBuildTask("worker-b", task.ID); err != nil {
+		t.Fatalf("CompleteBuildTask(worker-b): %v", err)
+	}
+	if current := loadBuildTask(t, s, task.ID); current.Status != buildStatusIdle {
+		t.Fatalf("task after completion: status=%s, want %s", current.Status, buildStatusIdle)
+	}
+}
+
+func TestReclaimBuildTasksFailsOrphanedRun(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.EnqueueClubBuildTask("club-1", 0); err != nil {
+		t.Fatalf("EnqueueClubBuildTask: %v", err)
+	}
+
+	now := time.Now().UTC()
+	task := claimOne(t, s, "worker-a", now)
+	run, err := s.StartBuildRun("worker-a", BuildScopeClubs, []string{"club-1"})
+	if err != nil {
+		t.Fatalf("StartBuildRun: %v", err)
+	}
+
+	// Nothing is reclaimed while the lease is still valid.
+	if reclaimed, err := s.ReclaimBuildTasks(now); err != nil || reclaimed != 0 {
+		t.Fatalf("ReclaimBuildTasks before expiry: reclaimed=%d err=%v", reclaimed, err)
+	}
+
+	reclaimed, err := s.ReclaimBuildTasks(now.Add(2 * testLease))
+	if err != nil {
+		t.Fatalf("ReclaimBuildTasks: %v", err)
+	}
+	if reclaimed != 1 {
+		t.Fatalf("ReclaimBuildTasks reclaimed %d tasks, want 1", reclaimed)
+	}
+
+	current := loadBuildTask(t, s, task.ID)
+	if current.Status != buildStatusPending || current.ClaimedBy != "" || current.LeaseExpiresAt != nil {
+		t.Fatalf("reclaimed task: status=%s claimed_by=%q lease=%v", current.Status, current.ClaimedBy, current.LeaseExpiresAt)
+	}
+
+	var failed BuildRun
+	if err := s.db.First(&failed, run.ID).Error; err != nil {
+		t.Fatalf("load build run: %v", err)
+	}
+	if failed.Status != BuildRunFailed || failed.FinishedAt == nil {
+		t.Fatalf("orphaned run: status=%s finished_at=%v, want failed", failed.Status, failed.FinishedAt)
+	}
+
+	if err := s.CompleteBuildTask("worker-a", task.ID); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("CompleteBuildTask(worker-a) after reclaim = %v, want ErrLeaseLost", err)
+	}
+}
+
+func TestEnqueueDuringBuildKeepsTaskPending(t *testing.T) {
+	s := newTestStore(t)
+	if err := s.EnqueueClubBuildTask("club-1", 0); err != nil {
+		t.Fatalf("EnqueueClubBuildTask: %v", err)
+	}
+
+	task := claimOne(t, s, "worker-a", time.Now().UTC())
+	time.Sleep(time.Millisecond)
+	if err := s.EnqueueClubBuildTask("club-1", 0); err != nil {
+		t.Fatalf("EnqueueClubBuildTask during build: %v", err)
+	}
+	if current := loadBuildTask(t, s, task.ID); current.Status != buildStatusRunning || current.ClaimedBy != "worker-a" {
+		t.Fatalf("enqueue took the task from its worker: status=%s claimed_by=%q", current.Status, current.ClaimedBy)
+	}
+
+	if err := s.CompleteBuildTask("worker-a", task.ID); err != nil {
+		t.Fatalf("CompleteBuildTask: %v", err)
+	}
+	current := loadBuildTask(t, s, task.ID)
+	if current.Status != buildStatusPending {
+		t.Fatalf("task after completion: status=%s, want %s", current.Status, buildStatusPending)
+	}
+
+	next := claimOne(t, s, "worker-a", time.Now().UTC())
+	if next.ID != task.ID {
+		t.Fatalf("claimed task %d, want %d", next.ID, task.ID)
+	}
+}
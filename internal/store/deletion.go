@@ -0,0 +1,170 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+
+type AccountExport struct {
+	ExportedAt     time.Time            `json:"exported_at"`
+	User           ExportedUser         `json:"user"`
+	Membership     *ClubMembership      `json:"membership,omitempty"`
+	Club           *Club                `json:"club,omitempty"`
+	Sessions       []Session            `json:"sessions"`
+	PasswordResets []PasswordResetToken `json:"password_resets"`
+	RecoveryCodes  []RecoveryCode       `json:"recovery_codes"`
+	AuditEvents    []AuditEvent         `json:"audit_events"`
+	ClubRevisions  []ClubRevision       `json:"club_revisions,omitempty"`
+}
+
+type ExportedUser struct {
+	ID                  string     `json:"id"`
+	Email               string     `json:"email"`
+	VerifiedAt          *time.Time `json:"verified_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	TOTPEnabledAt       *time.Time `json:"totp_enabled_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+}
+
+func (s *Store) ExportAccount(userID string) (AccountExport, error) {
+	var user User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return AccountExport{}, ErrUserNotFound
+		}
+		return AccountExport{}, err
+	}
+
+	export := AccountExport{
+		ExportedAt: time.Now().UTC(),
+		User: ExportedUser{
+			ID:                  user.ID,
+			Email:               user.Email,
+			VerifiedAt:          user.VerifiedAt,
+			CreatedAt:           user.CreatedAt,
+			TOTPEnabledAt:       user.TOTPEnabledAt,
+			DeletionScheduledAt: user.DeletionScheduledAt,
+		},
+	}
+
+	membership, err := membershipForUser(s.db, userID)
+	if err != nil && !errors.Is(err, ErrNotAllowed) {
+		return AccountExport{}, err
+	}
+	if err == nil {
+		export.Membership = &membership
+		if club, ok := s.GetClubForUser(userID); ok {
+			export.Club = &club
+			if err := s.db.Where("club_id = ?", club.ID).Order("id asc").Find(&export.ClubRevisions).Error; err != nil {
+				return AccountExport{}, err
+			}
+		}
+	}
+
+	if err := s.db.Where("user_id = ?", userID).Order("created_at asc").Find(&export.Sessions).Error; err != nil {
+		return AccountExport{}, err
+	}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at asc").Find(&export.PasswordResets).Error; err != nil {
+		return AccountExport{}, err
+	}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at asc").Find(&export.RecoveryCodes).Error; err != nil {
+		return AccountExport{}, err
+	}
+	if err := s.db.Where("actor_id = ? OR impersonator_id = ?", userID, userID).Order("created_at asc").Find(&export.AuditEvents).Error; err != nil {
+		return AccountExport{}, err
+	}
+
+	return export, nil
+}
+
+func (s *Store) ScheduleAccountDeletion(userID, password string, at time.Time) error {
+	var user User
+	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	return s.db.Model(&User{}).Where("id = ?", userID).
+		Update("deletion_scheduled_at", at.UTC()).Error
+}
+
+func (s *Store) CancelAccountDeletion(userID string) error {
+	result := s.db.Model(&User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", userID).
+		Update("deletion_scheduled_at", nil)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeletionNotScheduled
+	}
+	return nil
+}
+
+// PurgeScheduledDeletions removes every account whose grace period has run
+// out. A club goes with its account unless another owner is left to keep it.
+func (s *Store) PurgeScheduledDeletions(now time.Time) (int, error) {
+	var userIDs []string
+	if err := s.db.Model(&User{}).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", now.UTC()).
+		Pluck("id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		if err := s.db.Transaction(func(tx *gorm.DB) error {
+			return deleteAccount(tx, userID)
+		}); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func deleteAccount(tx *gorm.DB, userID string) error {
+	membership, err := membershipForUser(tx, userID)
+	if err != nil && !errors.Is(err, ErrNotAllowed) {
+		return err
+	}
+	if err == nil {
+		keepClub := membership.Role != RoleOwner || ensureAnotherOwner(tx, membership) == nil
+		if keepClub {
+			if err := tx.Delete(&membership).Error; err != nil {
+				return err
+			}
+			if err := handOverClub(tx, membership.ClubID, userID); err != nil {
+				return err
+			}
+		} else if err := deleteClub(tx, membership.ClubID); err != nil {
+			return err
+		}
+	}
+
+	for _, model := range []any{&Session{}, &PasswordResetToken{}, &RecoveryCode{}} {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("id = ?", userID).Delete(&User{}).Error
+}
+
+func deleteClub(tx *gorm.DB, clubID string) error {
+	for _, model := range []any{&OpeningHour{}, &Course{}, &ClubMembership{}, &AuditEvent{}, &ClubRevision{}} {
+		if err := tx.Where("club_id = ?", clubID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("id = ?", clubID).Delete(&Club{}).Error
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RoleOwner         = "owner"
+	RoleEditor        = "editor"
+	RoleCourseManager = "course_manager"
+)
+
+var (
+	ErrNotAllowed     = errors.New("not allowed")
+	ErrUserNotFound   = errors.New("user not found")
+	ErrAlreadyMember  = errors.New("user already belongs to a club")
+	ErrMemberNotFound = errors.New("membership not found")
+	ErrLastOwner      = errors.New("club needs at least one owner")
+	ErrInvalidRole    = errors.New("invalid role")
+)
+
+type ClubMembership struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ClubID    string    `json:"club_id" gorm:"index;size:32;not null"`
+	UserID    string    `json:"user_id" gorm:"uniqueIndex;size:32;not null"`
+	Role      string    `json:"role" gorm:"size:20;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type ClubMember struct {
+	UserID    string
+	Email     string
+	Role      string
+	CreatedAt time.Time
+}
+
+func ValidRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleEditor, RoleCourseManager:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m ClubMembership) CanEditClub() bool {
+	return m.Role == RoleOwner || m.Role == RoleEditor
+}
+
+func (m ClubMembership) CanEditCourses() bool {
+	return m.CanEditClub() || m.Role == RoleCourseManager
+}
+
+func (m ClubMembership) CanManageMembers() bool {
+	return m.Role == RoleOwner
+}
+
+func (s *Store) GetMembership(userID string) (ClubMembership, bool) {
+	var membership ClubMembership
+	if err := s.db.Where("user_id = ?", userID).First(&membership).Error; err != nil {
+		return ClubMembership{}, false
+	}
+	return membership, true
+}
+
+func (s *Store) ListMembers(clubID string) ([]ClubMember, error) {
+	var members []ClubMember
+	err := s.db.Table("club_memberships").
+		Select("club_memberships.user_id, users.email, club_memberships.role, club_memberships.created_at").
+		Joins("JOIN users ON users.id = club_memberships.user_id").
+		Where("club_memberships.club_id = ?", clubID).
+		Order("club_memberships.created_at asc").
+		Scan(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (s *Store) AddMember(actorID, email, role string) (ClubMembership, error) {
+	if !ValidRole(role) {
+		return ClubMembership{}, ErrInvalidRole
+	}
+
+	var result ClubMembership
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		actor, err := membershipForUser(tx, actorID)
+		if err != nil {
+			return err
+		}
+		if !actor.CanManageMembers() {
+			return ErrNotAllowed
+		}
+
+		var user User
+		err = tx.Select("id").Where("email = ?", normalizeEmail(email)).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&ClubMembership{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrAlreadyMember
+		}
+
+		result = ClubMembership{
+			ClubID: actor.ClubID,
+			UserID: user.ID,
+			Role:   role,
+		}
+		return tx.Create(&result).Error
+	})
+	if err != nil {
+		return ClubMembership{}, err
+	}
+	return result, nil
+}
+
+func (s *Store) ChangeMemberRole(actorID, userID, role string) error {
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		actor, err := membershipForUser(tx, actorID)
+		if err != nil {
+			return err
+		}
+		if !actor.CanManageMembers() {
+			return ErrNotAllowed
+		}
+
+		target, err := membershipForUser(tx, userID)
+		if errors.Is(err, ErrNotAllowed) || (err == nil && target.ClubID != actor.ClubID) {
+			return ErrMemberNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if target.Role == RoleOwner && role != RoleOwner {
+			if err := ensureAnotherOwner(tx, target); err != nil {
+				return err
+			}
+		}
+
+		target.Role = role
+		return tx.Save(&target).Error
+	})
+}
+
+func (s *Store) RemoveMember(actorID, userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		actor, err := membershipForUser(tx, actorID)
+		if err != nil {
+			return err
+		}
+		if actorID != userID && !actor.CanManageMembers() {
+			return ErrNotAllowed
+		}
+
+		target, err := membershipForUser(tx, userID)
+		if errors.Is(err, ErrNotAllowed) || (err == nil && target.ClubID != actor.ClubID) {
+			return ErrMemberNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if target.Role == RoleOwner {
+			if err := ensureAnotherOwner(tx, target); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Delete(&target).Error; err != nil {
+			return err
+		}
+
+		// clubs.owner_id is unique, so hand it over to a remaining owner to
+		// let the removed user create or join another club later.
+		return handOverClub(tx, target.ClubID, target.UserID)
+	})
+}
+
+func membershipForUser(tx *gorm.DB, userID string) (ClubMembership, error) {
+	var membership ClubMembership
+	err := tx.Where("user_id = ?", userID).First(&membership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ClubMembership{}, ErrNotAllowed
+	}
+	if err != nil {
+		return ClubMembership{}, err
+	}
+	return membership, nil
+}
+
+func ensureAnotherOwner(tx *gorm.DB, target ClubMembership) error {
+	var owners int64
+	if err := tx.Model(&ClubMembership{}).
+		Where("club_id = ? AND role = ? AND id <> ?", target.ClubID, RoleOwner, target.ID).
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func handOverClub(tx *gorm.DB, clubID, userID string) error {
+	var club Club
+	if err := tx.Select("id", "owner_id").First(&club, "id = ?", clubID).Error; err != nil {
+		return err
+	}
+	if club.OwnerID != userID {
+		return nil
+	}
+	var successor ClubMembership
+	if err := tx.Where("club_id = ? AND role = ?", clubID, RoleOwner).
+		Order("created_at asc").First(&successor).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Club{}).Where("id = ?", clubID).Update("owner_id", successor.UserID).Error
+}
+
+func backfillMemberships(db *gorm.DB) error {
+	var clubs []Club
+	if err := db.Select("id", "owner_id").
+		Where("owner_id NOT IN (?)", db.Model(&ClubMembership{}).Select("user_id")).
+		Find(&clubs).Error; err != nil {
+		return err
+	}
+
+	for _, club := range clubs {
+		membership := ClubMembership{
+			ClubID: club.ID,
+			UserID: club.OwnerID,
+			Role:   RoleOwner,
+		}
+		if err := db.Create(&membership).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
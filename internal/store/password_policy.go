@@ -0,0 +1,142 @@
+package store
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// bcrypt ignores everything after 72 bytes, so longer passwords would give a
+// false sense of security.
+const maxPasswordLength = 72
+
+var (
+	ErrPasswordTooLong       = errors.New("password too long")
+	ErrPasswordNeedsUpper    = errors.New("password needs an uppercase letter")
+	ErrPasswordNeedsLower    = errors.New("password needs a lowercase letter")
+	ErrPasswordNeedsDigit    = errors.New("password needs a digit")
+	ErrPasswordNeedsSymbol   = errors.New("password needs a symbol")
+	ErrPasswordContainsEmail = errors.New("password contains the email address")
+	ErrPasswordTooCommon     = errors.New("password is too common")
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = parseCommonPasswords(commonPasswordList)
+
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	RejectEmail   bool
+	RejectCommon  bool
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:    minPasswordLength,
+		MaxLength:    maxPasswordLength,
+		RejectEmail:  true,
+		RejectCommon: true,
+	}
+}
+
+func (s *Store) SetPasswordPolicy(policy PasswordPolicy) {
+	s.policyMu.Lock()
+	defer s.policyMu.Unlock()
+
+	if policy.MinLength <= 0 {
+		policy.MinLength = minPasswordLength
+	}
+	if policy.MaxLength <= 0 || policy.MaxLength > maxPasswordLength {
+		policy.MaxLength = maxPasswordLength
+	}
+	if policy.MinLength > policy.MaxLength {
+		policy.MinLength = policy.MaxLength
+	}
+	s.passwordPolicy = policy
+}
+
+func (s *Store) PasswordPolicy() PasswordPolicy {
+	s.policyMu.RLock()
+	defer s.policyMu.RUnlock()
+	return s.passwordPolicy
+}
+
+func (s *Store) validatePassword(email, password string) error {
+	return s.PasswordPolicy().Validate(email, password)
+}
+
+func (p PasswordPolicy) Validate(email, password string) error {
+	if len([]rune(password)) < p.MinLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > p.MaxLength {
+		return ErrPasswordTooLong
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	switch {
+	case p.RequireUpper && !hasUpper:
+		return ErrPasswordNeedsUpper
+	case p.RequireLower && !hasLower:
+		return ErrPasswordNeedsLower
+	case p.RequireDigit && !hasDigit:
+		return ErrPasswordNeedsDigit
+	case p.RequireSymbol && !hasSymbol:
+		return ErrPasswordNeedsSymbol
+	}
+
+	lower := strings.ToLower(password)
+	if p.RejectEmail && containsEmail(lower, normalizeEmail(email)) {
+		return ErrPasswordContainsEmail
+	}
+	if p.RejectCommon {
+		if _, ok := commonPasswords[lower]; ok {
+			return ErrPasswordTooCommon
+		}
+	}
+	return nil
+}
+
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	if strings.Contains(password, email) {
+		return true
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return len(local) >= 3 && strings.Contains(password, local)
+}
+
+func parseCommonPasswords(raw string) map[string]struct{} {
+	result := make(map[string]struct{})
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		result[line] = struct{}{}
+	}
+	return result
+}
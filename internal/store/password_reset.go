@@ -0,0 +1,125 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    string     `json:"user_id" gorm:"index;size:32;not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (s *Store) CreatePasswordResetToken(email string, ttl time.Duration) (string, User, error) {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	var user User
+	err := s.db.Where("email = ?", normalizeEmail(email)).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return "", User{}, err
+	}
+
+	token := newToken()
+	now := time.Now().UTC()
+	reset := PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.db.Create(&reset).Error; err != nil {
+		return "", User{}, err
+	}
+
+	return token, user, nil
+}
+
+func (s *Store) ValidPasswordResetToken(token string) bool {
+	_, err := activeResetToken(s.db, token, time.Now().UTC())
+	return err == nil
+}
+
+func (s *Store) ResetPassword(token, password string) (User, error) {
+	pending, err := activeResetToken(s.db, token, time.Now().UTC())
+	if err != nil {
+		return User{}, err
+	}
+	var owner User
+	if err := s.db.Select("email").First(&owner, "id = ?", pending.UserID).Error; err != nil {
+		return User{}, err
+	}
+	if err := s.validatePassword(owner.Email, password); err != nil {
+		return User{}, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return User{}, err
+	}
+
+	var user User
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		reset, err := activeResetToken(tx, token, now)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		if err := expireResetTokens(tx, reset.UserID, now); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&User{}).Where("id = ?", reset.UserID).
+			Update("password_hash", string(hash)).Error; err != nil {
+			return err
+		}
+
+		return tx.First(&user, "id = ?", reset.UserID).Error
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func activeResetToken(tx *gorm.DB, token string, now time.Time) (PasswordResetToken, error) {
+	if token == "" {
+		return PasswordResetToken{}, ErrInvalidResetToken
+	}
+
+	var reset PasswordResetToken
+	err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), now).
+		First(&reset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return PasswordResetToken{}, ErrInvalidResetToken
+	}
+	if err != nil {
+		return PasswordResetToken{}, err
+	}
+	return reset, nil
+}
@@ -0,0 +1,215 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	PlatformActionSuspend            = "club_suspend"
+	PlatformActionUnsuspend          = "club_unsuspend"
+	PlatformActionImpersonationStart = "impersonation_start"
+	PlatformActionImpersonationStop  = "impersonation_stop"
+)
+
+var ErrClubNotFound = errors.New("club not found")
+
+type PlatformAction struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ActorID      string    `json:"actor_id" gorm:"index;size:32;not null"`
+	Action       string    `json:"action" gorm:"size:40;not null"`
+	TargetUserID string    `json:"target_user_id" gorm:"index;size:32"`
+	TargetClubID string    `json:"target_club_id" gorm:"index;size:32"`
+	Detail       string    `json:"detail" gorm:"size:400"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime;index"`
+}
+
+type PlatformActionEntry struct {
+	Action      string
+	ActorEmail  string
+	TargetEmail string
+	ClubName    string
+	Detail      string
+	CreatedAt   time.Time
+}
+
+type UserOverview struct {
+	ID                  string
+	Email               string
+	VerifiedAt          *time.Time
+	IsPlatformAdmin     bool
+	DeletionScheduledAt *time.Time
+	CreatedAt           time.Time
+	ClubID              string
+	ClubName            string
+	Role                string
+}
+
+type ClubOverview struct {
+	ID              string
+	Name            string
+	Slug            string
+	OwnerEmail      string
+	SuspendedAt     *time.Time
+	SuspendedReason string
+	CreatedAt       time.Time
+}
+
+// SyncPlatformAdmins makes exactly the given addresses platform admins and
+// returns the ones that do not belong to a registered user yet.
+func (s *Store) SyncPlatformAdmins(emails []string) ([]string, error) {
+	clean := make([]string, 0, len(emails))
+	for _, email := range emails {
+		if normalized := normalizeEmail(email); normalized != "" {
+			clean = append(clean, normalized)
+		}
+	}
+
+	var missing []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		revoke := tx.Model(&User{}).Where("is_platform_admin = ?", true)
+		if len(clean) > 0 {
+			revoke = revoke.Where("email NOT IN ?", clean)
+		}
+		if err := revoke.Update("is_platform_admin", false).Error; err != nil {
+			return err
+		}
+		if len(clean) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&User{}).Where("email IN ?", clean).
+			Update("is_platform_admin", true).Error; err != nil {
+			return err
+		}
+
+		var found []string
+		if err := tx.Model(&User{}).Where("email IN ?", clean).Pluck("email", &found).Error; err != nil {
+			return err
+		}
+		known := make(map[string]bool, len(found))
+		for _, email := range found {
+			known[email] = true
+		}
+		for _, email := range clean {
+			if !known[email] {
+				missing = append(missing, email)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+func (s *Store) SearchUsers(query string, limit int) ([]UserOverview, error) {
+	var users []UserOverview
+	db := s.db.Table("users").
+		Select("users.id, users.email, users.verified_at, users.is_platform_admin, users.deletion_scheduled_at, users.created_at, " +
+			"COALESCE(clubs.id, '') AS club_id, COALESCE(clubs.name, '') AS club_name, COALESCE(club_memberships.role, '') AS role").
+		Joins("LEFT JOIN club_memberships ON club_memberships.user_id = users.id").
+		Joins("LEFT JOIN clubs ON clubs.id = club_memberships.club_id")
+	if pattern := likePattern(query); pattern != "" {
+		db = db.Where("users.email LIKE ? ESCAPE '\\' OR clubs.name LIKE ? ESCAPE '\\'", pattern, pattern)
+	}
+	if err := db.Order("users.created_at desc").Limit(limit).Scan(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (s *Store) SearchClubs(query string, limit int) ([]ClubOverview, error) {
+	var clubs []ClubOverview
+	db := s.db.Table("clubs").
+		Select("clubs.id, clubs.name, clubs.slug, COALESCE(users.email, '') AS owner_email, " +
+			"clubs.suspended_at, clubs.suspended_reason, clubs.created_at").
+		Joins("LEFT JOIN users ON users.id = clubs.owner_id")
+	if pattern := likePattern(query); pattern != "" {
+		db = db.Where("clubs.name LIKE ? ESCAPE '\\' OR clubs.slug LIKE ? ESCAPE '\\' OR users.email LIKE ? ESCAPE '\\'", pattern, pattern, pattern)
+	}
+	if err := db.Order("clubs.name asc").Limit(limit).Scan(&clubs).Error; err != nil {
+		return nil, err
+	}
+	return clubs, nil
+}
+
+func (s *Store) SuspendClub(actorID, clubID, reason string) error {
+	return s.setClubSuspension(actorID, clubID, true, strings.TrimSpace(reason))
+}
+
+func (s *Store) UnsuspendClub(actorID, clubID string) error {
+	return s.setClubSuspension(actorID, clubID, false, "")
+}
+
+func (s *Store) setClubSuspension(actorID, clubID string, suspend bool, reason string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var club Club
+		err := tx.Select("id", "suspended_at").First(&club, "id = ?", clubID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrClubNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if (club.SuspendedAt != nil) == suspend {
+			return nil
+		}
+
+		action := PlatformActionUnsuspend
+		updates := map[string]any{"suspended_at": nil, "suspended_reason": ""}
+		if suspend {
+			action = PlatformActionSuspend
+			updates = map[string]any{"suspended_at": time.Now().UTC(), "suspended_reason": reason}
+		}
+		if err := tx.Model(&Club{}).Where("id = ?", clubID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return recordPlatformAction(tx, PlatformAction{
+			ActorID:      actorID,
+			Action:       action,
+			TargetClubID: clubID,
+			Detail:       reason,
+		})
+	})
+}
+
+func (s *Store) RecordPlatformAction(action PlatformAction) error {
+	return recordPlatformAction(s.db, action)
+}
+
+func (s *Store) RecentPlatformActions(limit int) ([]PlatformActionEntry, error) {
+	var entries []PlatformActionEntry
+	err := s.db.Table("platform_actions").
+		Select("platform_actions.action, platform_actions.detail, platform_actions.created_at, " +
+			"COALESCE(actors.email, platform_actions.actor_id) AS actor_email, " +
+			"COALESCE(targets.email, platform_actions.target_user_id) AS target_email, " +
+			"COALESCE(clubs.name, platform_actions.target_club_id) AS club_name").
+		Joins("LEFT JOIN users AS actors ON actors.id = platform_actions.actor_id").
+		Joins("LEFT JOIN users AS targets ON targets.id = platform_actions.target_user_id").
+		Joins("LEFT JOIN clubs ON clubs.id = platform_actions.target_club_id").
+		Order("platform_actions.created_at desc").Order("platform_actions.id desc").
+		Limit(limit).Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func recordPlatformAction(tx *gorm.DB, action PlatformAction) error {
+	action.CreatedAt = time.Now().UTC()
+	return tx.Create(&action).Error
+}
+
+func likePattern(query string) string {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return ""
+	}
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + escaper.Replace(query) + "%"
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const AuditEntityPublication = "publication"
+
+type PublicationState struct {
+	PublishedAt       *time.Time
+	PublishedSlug     string
+	UnpublishedChange bool
+}
+
+// PublishClub copies the current draft of the club into its published
+// snapshot. Only the published snapshot is ever shown on the public site.
+func (s *Store) PublishClub(actor Actor, clubID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		membership, err := membershipForUser(tx, actor.UserID)
+		if err != nil {
+			return err
+		}
+		if membership.ClubID != clubID || !membership.CanEditClub() {
+			return ErrNotAllowed
+		}
+		return publishClub(tx, actor, clubID)
+	})
+}
+
+func (s *Store) ClubPublicationState(clubID string) (PublicationState, error) {
+	club, err := loadClub(s.db, clubID)
+	if err != nil {
+		return PublicationState{}, err
+	}
+
+	state := PublicationState{
+		PublishedAt:   club.PublishedAt,
+		PublishedSlug: club.PublishedSlug,
+	}
+	draft, err := json.Marshal(snapshotOf(club))
+	if err != nil {
+		return PublicationState{}, err
+	}
+	state.UnpublishedChange = club.PublishedAt == nil || string(draft) != club.PublishedSnapshot
+	return state, nil
+}
+
+func publishClub(tx *gorm.DB, actor Actor, clubID string) error {
+	club, err := loadClub(tx, clubID)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(snapshotOf(club))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if err := tx.Model(&Club{}).Where("id = ?", clubID).Updates(map[string]any{
+		"published_at":       now,
+		"published_slug":     club.Slug,
+		"published_snapshot": string(encoded),
+	}).Error; err != nil {
+		return err
+	}
+
+	previous := ""
+	if club.PublishedAt != nil {
+		previous = club.PublishedAt.Format(time.RFC3339)
+	}
+	return recordAuditEvent(tx, clubID, actor, AuditEntityPublication, []FieldChange{
+		{Field: "published_at", Old: previous, New: now.Format(time.RFC3339)},
+	})
+}
+
+// publishedView replaces the draft content of a club with its published
+// snapshot, keeping identity fields like ID and owner.
+func publishedView(club Club) (Club, error) {
+	var snapshot ClubSnapshot
+	if err := json.Unmarshal([]byte(club.PublishedSnapshot), &snapshot); err != nil {
+		return Club{}, err
+	}
+
+	update := snapshot.Club
+	club.Name = update.Name
+	club.Description = update.Description
+	club.Categories = update.Categories
+	club.Slug = club.PublishedSlug
+	club.ContactName = update.ContactName
+	club.ContactRole = update.ContactRole
+	club.ContactEmail = update.ContactEmail
+	club.ContactPhone = update.ContactPhone
+	club.ContactWebsite = update.ContactWebsite
+	club.AddressLine1 = update.AddressLine1
+	club.AddressLine2 = update.AddressLine2
+	club.AddressPostal = update.AddressPostal
+	club.AddressCity = update.AddressCity
+	club.AddressCountry = update.AddressCountry
+	if club.PublishedAt != nil {
+		club.UpdatedAt = *club.PublishedAt
+	}
+
+	club.OpeningHours = snapshotOpeningHours(snapshot)
+	club.Courses = snapshotCourses(snapshot)
+	for i := range club.OpeningHours {
+		club.OpeningHours[i].ClubID = club.ID
+	}
+	for i := range club.Courses {
+		club.Courses[i].ClubID = club.ID
+	}
+	return club, nil
+}
+
+// backfillPublications publishes every existing club once, so pages that were
+// live before drafts existed stay online.
+func backfillPublications(db *gorm.DB) error {
+	var clubIDs []string
+	if err := db.Model(&Club{}).Where("published_at IS NULL").Pluck("id", &clubIDs).Error; err != nil {
+		return err
+	}
+	for _, clubID := range clubIDs {
+		var club Club
+		if err := db.Select("owner_id").First(&club, "id = ?", clubID).Error; err != nil {
+			return err
+		}
+		if err := publishClub(db, Actor{UserID: club.OwnerID}, clubID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrRevisionNotFound = errors.New("revision not found")
+
+type ClubRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ClubID    string    `json:"club_id" gorm:"index;size:32;not null"`
+	ActorID   string    `json:"actor_id" gorm:"size:32;not null"`
+	Snapshot  string    `json:"snapshot" gorm:"type:text;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+type ClubSnapshot struct {
+	Club         ClubUpdate         `json:"club"`
+	Slug         string             `json:"slug,omitempty"`
+	OpeningHours []OpeningHourInput `json:"opening_hours"`
+	Courses      []CourseInput      `json:"courses"`
+}
+
+type RevisionEntry struct {
+	ID         uint
+	ActorEmail string
+	CreatedAt  time.Time
+}
+
+type RevisionChange struct {
+	Entity string
+	FieldChange
+}
+
+// SaveClubRevision snapshots the current state of the club and keeps at most
+// keep revisions. Saving an unchanged club does not add a revision.
+func (s *Store) SaveClubRevision(actorID, clubID string, keep int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return saveClubRevision(tx, actorID, clubID, keep)
+	})
+}
+
+// SaveClubDraft stores the dashboard form of an owner or admin: the club, its
+// opening hours, its courses and a revision of the result commit together,
+// so a save never goes missing from the version history.
+func (s *Store) SaveClubDraft(actor Actor, update ClubUpdate, hours []OpeningHourInput, courses []CourseInput, keepRevisions int) (Club, error) {
+	var club Club
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		club, err = upsertClub(tx, actor, update, "")
+		if err != nil {
+			return err
+		}
+		if err := replaceOpeningHours(tx, actor, club.ID, hours); err != nil {
+			return err
+		}
+		if err := replaceCourses(tx, actor, club.ID, courses); err != nil {
+			return err
+		}
+		return saveClubRevision(tx, actor.UserID, club.ID, keepRevisions)
+	})
+	if err != nil {
+		return Club{}, err
+	}
+	return club, nil
+}
+
+// SaveClubCourses is SaveClubDraft for members who may only edit the courses.
+func (s *Store) SaveClubCourses(actor Actor, clubID string, courses []CourseInput, keepRevisions int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := replaceCourses(tx, actor, clubID, courses); err != nil {
+			return err
+		}
+		return saveClubRevision(tx, actor.UserID, clubID, keepRevisions)
+	})
+}
+
+func saveClubRevision(tx *gorm.DB, actorID, clubID string, keep int) error {
+	club, err := loadClub(tx, clubID)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(snapshotOf(club))
+	if err != nil {
+		return err
+	}
+
+	var latest ClubRevision
+	err = tx.Where("club_id = ?", clubID).Order("id desc").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && latest.Snapshot == string(encoded) {
+		return nil
+	}
+
+	if err := tx.Create(&ClubRevision{
+		ClubID:    clubID,
+		ActorID:   actorID,
+		Snapshot:  string(encoded),
+		CreatedAt: time.Now().UTC(),
+	}).Error; err != nil {
+		return err
+	}
+
+	if keep <= 0 {
+		return nil
+	}
+	return tx.Where("club_id = ? AND id NOT IN (?)", clubID,
+		tx.Model(&ClubRevision{}).Select("id").Where("club_id = ?", clubID).Order("id desc").Limit(keep)).
+		Delete(&ClubRevision{}).Error
+}
+
+func (s *Store) ClubRevisions(clubID string) ([]RevisionEntry, error) {
+	var entries []RevisionEntry
+	err := s.db.Table("club_revisions").
+		Select("club_revisions.id, club_revisions.created_at, COALESCE(users.email, club_revisions.actor_id) AS actor_email").
+		Joins("LEFT JOIN users ON users.id = club_revisions.actor_id").
+		Where("club_revisions.club_id = ?", clubID).
+		Order("club_revisions.id desc").
+		Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// CompareClubRevision lists every field where the revision differs from the
+// current club. Old holds the revision's value, New the current one.
+func (s *Store) CompareClubRevision(clubID string, revisionID uint) ([]RevisionChange, error) {
+	snapshot, err := revisionSnapshot(s.db, clubID, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	club, err := loadClub(s.db, clubID)
+	if err != nil {
+		return nil, err
+	}
+	current := snapshotOf(club)
+
+	var changes []RevisionChange
+	appendChanges := func(entity string, fieldChanges []FieldChange) {
+		for _, change := range fieldChanges {
+			changes = append(changes, RevisionChange{Entity: entity, FieldChange: change})
+		}
+	}
+	appendChanges(AuditEntityClub, diffFields(snapshotClubFields(snapshot), snapshotClubFields(current)))
+	appendChanges(AuditEntityOpeningHours, diffFields(openingHourAuditFields(snapshotOpeningHours(snapshot)), openingHourAuditFields(snapshotOpeningHours(current))))
+	appendChanges(AuditEntityCourses, diffFields(courseAuditFields(snapshotCourses(snapshot)), courseAuditFields(snapshotCourses(current))))
+	return changes, nil
+}
+
+// RestoreClubRevision writes the revision back in one transaction through the
+// helpers of a regular save, so permissions and the audit log behave like a
+// manual save, and records the result as the newest revision. The slug of the
+// revision comes back too unless another club took it in the meantime.
+func (s *Store) RestoreClubRevision(actor Actor, clubID string, revisionID uint, keepRevisions int) (Club, error) {
+	var club Club
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		snapshot, err := revisionSnapshot(tx, clubID, revisionID)
+		if err != nil {
+			return err
+		}
+
+		club, err = upsertClub(tx, actor, snapshot.Club, snapshot.Slug)
+		if err != nil {
+			return err
+		}
+		if club.ID != clubID {
+			return ErrNotAllowed
+		}
+		if err := replaceOpeningHours(tx, actor, clubID, snapshot.OpeningHours); err != nil {
+			return err
+		}
+		if err := replaceCourses(tx, actor, clubID, snapshot.Courses); err != nil {
+			return err
+		}
+		return saveClubRevision(tx, actor.UserID, clubID, keepRevisions)
+	})
+	if err != nil {
+		return Club{}, err
+	}
+	return club, nil
+}
+
+func revisionSnapshot(tx *gorm.DB, clubID string, revisionID uint) (ClubSnapshot, error) {
+	var revision ClubRevision
+	err := tx.Where("id = ? AND club_id = ?", revisionID, clubID).First(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ClubSnapshot{}, ErrRevisionNotFound
+	}
+	if err != nil {
+		return ClubSnapshot{}, err
+	}
+
+	var snapshot ClubSnapshot
+	if err := json.Unmarshal([]byte(revision.Snapshot), &snapshot); err != nil {
+		return ClubSnapshot{}, err
+	}
+	return snapshot, nil
+}
+
+func loadClub(tx *gorm.DB, clubID string) (Club, error) {
+	var club Club
+	err := tx.Preload("OpeningHours", orderOpeningHours).
+		Preload("Courses", orderCourses).
+		First(&club, "id = ?", clubID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Club{}, ErrClubNotFound
+	}
+	return club, err
+}
+
+func snapshotOf(club Club) ClubSnapshot {
+	snapshot := ClubSnapshot{
+		Club: ClubUpdate{
+			Name:           club.Name,
+			Description:    club.Description,
+			Categories:     club.Categories,
+			ContactName:    club.ContactName,
+			ContactRole:    club.ContactRole,
+			ContactEmail:   club.ContactEmail,
+			ContactPhone:   club.ContactPhone,
+			ContactWebsite: club.ContactWebsite,
+			AddressLine1:   club.AddressLine1,
+			AddressLine2:   club.AddressLine2,
+			AddressPostal:  club.AddressPostal,
+			AddressCity:    club.AddressCity,
+			AddressCountry: club.AddressCountry,
+		},
+		Slug:         club.Slug,
+		OpeningHours: make([]OpeningHourInput, 0, len(club.OpeningHours)),
+		Courses:      make([]CourseInput, 0, len(club.Courses)),
+	}
+	for _, hour := range club.OpeningHours {
+		snapshot.OpeningHours = append(snapshot.OpeningHours, OpeningHourInput{
+			DayOfWeek: hour.DayOfWeek,
+			OpensAt:   hour.OpensAt,
+			ClosesAt:  hour.ClosesAt,
+			Note:      hour.Note,
+		})
+	}
+	for _, course := range club.Courses {
+		snapshot.Courses = append(snapshot.Courses, CourseInput{
+			DayOfWeek:   course.DayOfWeek,
+			Title:       course.Title,
+			StartTime:   course.StartTime,
+			EndTime:     course.EndTime,
+			Location:    course.Location,
+			Instructor:  course.Instructor,
+			Level:       course.Level,
+			Description: course.Description,
+		})
+	}
+	return snapshot
+}
+
+func snapshotClubFields(snapshot ClubSnapshot) []auditField {
+	update := snapshot.Club
+	return clubAuditFields(Club{
+		Slug:           snapshot.Slug,
+		Name:           update.Name,
+		Description:    update.Description,
+		Categories:     update.Categories,
+		ContactName:    update.ContactName,
+		ContactRole:    update.ContactRole,
+		ContactEmail:   update.ContactEmail,
+		ContactPhone:   update.ContactPhone,
+		ContactWebsite: update.ContactWebsite,
+		AddressLine1:   update.AddressLine1,
+		AddressLine2:   update.AddressLine2,
+		AddressPostal:  update.AddressPostal,
+		AddressCity:    update.AddressCity,
+		AddressCountry: update.AddressCountry,
+	})
+}
+
+func snapshotOpeningHours(snapshot ClubSnapshot) []OpeningHour {
+	hours := make([]OpeningHour, 0, len(snapshot.OpeningHours))
+	for _, hour := range snapshot.OpeningHours {
+		hours = append(hours, OpeningHour{
+			DayOfWeek: hour.DayOfWeek,
+			OpensAt:   hour.OpensAt,
+			ClosesAt:  hour.ClosesAt,
+			Note:      hour.Note,
+		})
+	}
+	return hours
+}
+
+func snapshotCourses(snapshot ClubSnapshot) []Course {
+	courses := make([]Course, 0, len(snapshot.Courses))
+	for _, course := range snapshot.Courses {
+		courses = append(courses, Course{
+			DayOfWeek:   course.DayOfWeek,
+			Title:       course.Title,
+			StartTime:   course.StartTime,
+			EndTime:     course.EndTime,
+			Location:    course.Location,
+			Instructor:  course.Instructor,
+			Level:       course.Level,
+			Description: course.Description,
+		})
+	}
+	return courses
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func createTestUser(t *testing.T, s *Store, email string) User {
+	t.Helper()
+
+	user, err := s.CreateUser(email, "Turnhalle-Sonntag-42")
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+	return user
+}
+
+func TestRestoreClubRevisionRestoresEverything(t *testing.T) {
+	s := newTestStore(t)
+	other := Actor{UserID: createTestUser(t, s, "kickers@example.org").ID}
+	owner := Actor{UserID: createTestUser(t, s, "vorstand@example.org").ID}
+
+	// The other club holds "sportfreunde", so the revision is saved with a
+	// slug that no longer follows from the name once that club is renamed.
+	if _, err := s.UpsertClub(other, ClubUpdate{Name: "Sportfreunde"}); err != nil {
+		t.Fatalf("UpsertClub(other): %v", err)
+	}
+	club, err := s.UpsertClub(owner, ClubUpdate{Name: "Sportfreunde", Description: "Seit 1922"})
+	if err != nil {
+		t.Fatalf("UpsertClub(owner): %v", err)
+	}
+	if club.Slug != "sportfreunde-2" {
+		t.Fatalf("slug = %q, want sportfreunde-2", club.Slug)
+	}
+	hours := []OpeningHourInput{{DayOfWeek: 1, OpensAt: "09:00", ClosesAt: "12:00"}}
+	if err := s.ReplaceOpeningHours(owner, club.ID, hours); err != nil {
+		t.Fatalf("ReplaceOpeningHours: %v", err)
+	}
+	courses := []CourseInput{{DayOfWeek: 2, Title: "Lauftreff", StartTime: "18:00", EndTime: "19:00"}}
+	if err := s.ReplaceCourses(owner, club.ID, courses); err != nil {
+		t.Fatalf("ReplaceCourses: %v", err)
+	}
+	if err := s.SaveClubRevision(owner.UserID, club.ID, 10); err != nil {
+		t.Fatalf("SaveClubRevision: %v", err)
+	}
+	revisions, err := s.ClubRevisions(club.ID)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("ClubRevisions: %v (%d revisions)", err, len(revisions))
+	}
+
+	if _, err := s.UpsertClub(other, ClubUpdate{Name: "Kickers"}); err != nil {
+		t.Fatalf("rename other club: %v", err)
+	}
+	if _, err := s.UpsertClub(owner, ClubUpdate{Name: "Sportfreunde Ost"}); err != nil {
+		t.Fatalf("rename club: %v", err)
+	}
+	if err := s.ReplaceOpeningHours(owner, club.ID, nil); err != nil {
+		t.Fatalf("clear opening hours: %v", err)
+	}
+	if err := s.ReplaceCourses(owner, club.ID, nil); err != nil {
+		t.Fatalf("clear courses: %v", err)
+	}
+
+	if _, err := s.RestoreClubRevision(owner, club.ID, revisions[0].ID, 10); err != nil {
+		t.Fatalf("RestoreClubRevision: %v", err)
+	}
+	changes, err := s.CompareClubRevision(club.ID, revisions[0].ID)
+	if err != nil {
+		t.Fatalf("CompareClubRevision: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("club differs from the restored revision: %+v", changes)
+	}
+	restored, err := loadClub(s.db, club.ID)
+	if err != nil {
+		t.Fatalf("loadClub: %v", err)
+	}
+	if restored.Slug != "sportfreunde-2" {
+		t.Errorf("restored slug = %q, want sportfreunde-2", restored.Slug)
+	}
+}
+
+func TestRestoreClubRevisionRollsBackForeignClub(t *testing.T) {
+	s := newTestStore(t)
+	owner := Actor{UserID: createTestUser(t, s, "vorstand@example.org").ID}
+	outsider := Actor{UserID: createTestUser(t, s, "fremd@example.org").ID}
+
+	club, err := s.UpsertClub(owner, ClubUpdate{Name: "Sportfreunde"})
+	if err != nil {
+		t.Fatalf("UpsertClub: %v", err)
+	}
+	if err := s.SaveClubRevision(owner.UserID, club.ID, 10); err != nil {
+		t.Fatalf("SaveClubRevision: %v", err)
+	}
+	revisions, err := s.ClubRevisions(club.ID)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("ClubRevisions: %v (%d revisions)", err, len(revisions))
+	}
+
+	// Without a membership the upsert would create a club for the outsider;
+	// the restore has to roll that back.
+	if _, err := s.RestoreClubRevision(outsider, club.ID, revisions[0].ID, 10); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("RestoreClubRevision(outsider) = %v, want ErrNotAllowed", err)
+	}
+	if _, ok := s.GetClubForUser(outsider.UserID); ok {
+		t.Fatal("failed restore left a club behind for the outsider")
+	}
+}
+
+func TestSaveClubDraftRecordsRevision(t *testing.T) {
+	s := newTestStore(t)
+	owner := Actor{UserID: createTestUser(t, s, "vorstand@example.org").ID}
+
+	hours := []OpeningHourInput{{DayOfWeek: 1, OpensAt: "09:00", ClosesAt: "12:00"}}
+	courses := []CourseInput{{DayOfWeek: 2, Title: "Lauftreff", StartTime: "18:00", EndTime: "19:00"}}
+	club, err := s.SaveClubDraft(owner, ClubUpdate{Name: "Sportfreunde"}, hours, courses, 10)
+	if err != nil {
+		t.Fatalf("SaveClubDraft: %v", err)
+	}
+	revisions, err := s.ClubRevisions(club.ID)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("ClubRevisions: %v (%d revisions)", err, len(revisions))
+	}
+	if changes, err := s.CompareClubRevision(club.ID, revisions[0].ID); err != nil || len(changes) != 0 {
+		t.Fatalf("revision does not match the saved club: %+v (err %v)", changes, err)
+	}
+
+	// A failed save leaves neither the club nor the history changed.
+	if _, err := s.SaveClubDraft(owner, ClubUpdate{}, nil, nil, 10); !errors.Is(err, ErrNameRequired) {
+		t.Fatalf("SaveClubDraft without name = %v, want ErrNameRequired", err)
+	}
+	if revisions, _ := s.ClubRevisions(club.ID); len(revisions) != 1 {
+		t.Fatalf("failed save added a revision: %d revisions", len(revisions))
+	}
+}
@@ -0,0 +1,27 @@
+package store
+
+import "testing"
+
+func TestEnsureExampleClubSeedsFreshDatabase(t *testing.T) {
+	s := newTestStore(t)
+	// A policy the seed password cannot meet must not stop the seeding.
+	s.SetPasswordPolicy(PasswordPolicy{MinLength: 64, MaxLength: 72, RequireSymbol: true})
+
+	seed, created, err := s.EnsureExampleClub()
+	if err != nil {
+		t.Fatalf("EnsureExampleClub: %v", err)
+	}
+	if !created {
+		t.Fatal("expected the example club to be created")
+	}
+	if _, err := s.Authenticate(seed.Email, seed.Password); err != nil {
+		t.Fatalf("seed account cannot log in: %v", err)
+	}
+	if clubs := s.AllClubs(); len(clubs) != 1 || clubs[0].Name != seed.Club.Name {
+		t.Fatalf("expected the example club to be public, got %+v", clubs)
+	}
+
+	if _, created, err := s.EnsureExampleClub(); err != nil || created {
+		t.Fatalf("second EnsureExampleClub: created=%v err=%v", created, err)
+	}
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func (s *Store) SaveSession(token, userID, impersonatorID string, expiresAt time.Time, pending bool) error {
+	session := Session{
+		TokenHash:      hashToken(token),
+		UserID:         userID,
+		ExpiresAt:      expiresAt.UTC(),
+		Pending:        pending,
+		CreatedAt:      time.Now().UTC(),
+		ImpersonatorID: impersonatorID,
+	}
+
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "expires_at", "pending", "impersonator_id"}),
+	}).Create(&session).Error
+}
+
+// RefreshSession moves the expiry of an existing session. Unlike SaveSession
+// it never inserts, so a session revoked in the meantime stays revoked.
+func (s *Store) RefreshSession(token, userID string, expiresAt time.Time) error {
+	return s.db.Model(&Session{}).
+		Where("token_hash = ? AND user_id = ?", hashToken(token), userID).
+		Update("expires_at", expiresAt.UTC()).Error
+}
+
+func (s *Store) GetSession(token string) (Session, bool, error) {
+	var session Session
+	err := s.db.Where("token_hash = ?", hashToken(token)).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Session{}, false, nil
+	}
+	if err != nil {
+		return Session{}, false, err
+	}
+	return session, true, nil
+}
+
+func (s *Store) DeleteSession(token string) error {
+	return s.db.Where("token_hash = ?", hashToken(token)).Delete(&Session{}).Error
+}
+
+func (s *Store) DeleteUserSessions(userID string) error {
+	return s.db.Where("user_id = ?", userID).Delete(&Session{}).Error
+}
+
+func (s *Store) DeleteExpiredSessions(now time.Time) (int64, error) {
+	result := s.db.Where("expires_at < ?", now.UTC()).Delete(&Session{})
+	return result.RowsAffected, result.Error
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
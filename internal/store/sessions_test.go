@@ -0,0 +1,49 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	s, err := NewStore(filepath.Join(t.TempDir(), "store.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestRefreshSessionDoesNotRestoreDeletedSession(t *testing.T) {
+	s := newTestStore(t)
+	expiresAt := time.Now().UTC().Add(time.Hour)
+
+	if err := s.SaveSession("token", "user-1", "", expiresAt, false); err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+	if err := s.RefreshSession("token", "user-1", expiresAt.Add(time.Hour)); err != nil {
+		t.Fatalf("RefreshSession: %v", err)
+	}
+	session, ok, err := s.GetSession("token")
+	if err != nil || !ok {
+		t.Fatalf("GetSession: ok=%v err=%v", ok, err)
+	}
+	if !session.ExpiresAt.Equal(expiresAt.Add(time.Hour)) {
+		t.Fatalf("expires_at = %v, want %v", session.ExpiresAt, expiresAt.Add(time.Hour))
+	}
+
+	// A logout or a revocation of all sessions can land between loading the
+	// session and writing back its new expiry.
+	if err := s.DeleteUserSessions("user-1"); err != nil {
+		t.Fatalf("DeleteUserSessions: %v", err)
+	}
+	if err := s.RefreshSession("token", "user-1", expiresAt.Add(2*time.Hour)); err != nil {
+		t.Fatalf("RefreshSession: %v", err)
+	}
+	if _, ok, err := s.GetSession("token"); err != nil || ok {
+		t.Fatalf("revoked session is back: ok=%v err=%v", ok, err)
+	}
+}
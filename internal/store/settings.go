@@ -0,0 +1,37 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Setting struct {
+	Key   string `json:"key" gorm:"primaryKey;size:80"`
+	Value string `json:"value" gorm:"not null"`
+}
+
+func (s *Store) EnsureSecret(key string) ([]byte, error) {
+	var buf [32]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return nil, err
+	}
+
+	// Insert-or-keep so that concurrent processes end up with the same secret.
+	candidate := Setting{Key: key, Value: hex.EncodeToString(buf[:])}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&candidate).Error; err != nil {
+		return nil, err
+	}
+
+	var setting Setting
+	if err := s.db.First(&setting, "key = ?", key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("secret not persisted")
+		}
+		return nil, err
+	}
+	return hex.DecodeString(setting.Value)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -21,21 +22,52 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrNameRequired       = errors.New("club name is required")
 	ErrPasswordTooShort   = errors.New("password too short")
+	ErrEmailChanged       = errors.New("email changed since verification was requested")
+	ErrEmailRequired      = errors.New("email is required")
+	ErrEmailUnchanged     = errors.New("email is unchanged")
+	ErrLeaseLost          = errors.New("build task is claimed by another worker")
 )
 
 const (
 	minPasswordLength  = 8
 	buildTaskKey       = "site_build"
+	clubBuildKeyPrefix = "club:"
 	buildStatusIdle    = "idle"
 	buildStatusPending = "pending"
 	buildStatusRunning = "running"
 )
 
 type User struct {
-	ID           string    `json:"id" gorm:"primaryKey;size:32"`
-	Email        string    `json:"email" gorm:"uniqueIndex;size:320;not null"`
-	PasswordHash string    `json:"password_hash" gorm:"not null"`
-	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+	ID           string     `json:"id" gorm:"primaryKey;size:32"`
+	Email        string     `json:"email" gorm:"uniqueIndex;size:320;not null"`
+	PasswordHash string     `json:"password_hash" gorm:"not null"`
+	VerifiedAt   *time.Time `json:"verified_at" gorm:"index"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"autoCreateTime"`
+
+	TOTPSecret    string     `json:"-" gorm:"column:totp_secret;size:64"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at" gorm:"column:totp_enabled_at"`
+	TOTPLastStep  int64      `json:"-" gorm:"column:totp_last_step"`
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at" gorm:"index"`
+	IsPlatformAdmin     bool       `json:"is_platform_admin" gorm:"not null;default:false"`
+}
+
+func (u User) Verified() bool {
+	return u.VerifiedAt != nil
+}
+
+func (u User) TOTPEnabled() bool {
+	return u.TOTPEnabledAt != nil
+}
+
+type Session struct {
+	TokenHash string    `json:"-" gorm:"primaryKey;size:64"`
+	UserID    string    `json:"user_id" gorm:"index;size:32;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+	Pending   bool      `json:"pending" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+
+	ImpersonatorID string `json:"impersonator_id,omitempty" gorm:"size:32"`
 }
 
 type Club struct {
@@ -58,6 +90,13 @@ type Club struct {
 	AddressCity    string `json:"address_city" gorm:"size:120"`
 	AddressCountry string `json:"address_country" gorm:"size:120"`
 
+	PublishedAt       *time.Time `json:"published_at" gorm:"index"`
+	PublishedSlug     string     `json:"published_slug" gorm:"index;size:160"`
+	PublishedSnapshot string     `json:"-" gorm:"type:text"`
+
+	SuspendedAt     *time.Time `json:"suspended_at" gorm:"index"`
+	SuspendedReason string     `json:"suspended_reason" gorm:"size:400"`
+
 	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
 
@@ -87,24 +126,32 @@ type Course struct {
 	Description string `json:"description" gorm:"size:400"`
 }
 
+// BuildTask is either the global site build (empty ClubID) or the build of a
+// single club page, so edits of one club never debounce another.
 type BuildTask struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
 	Key         string    `json:"key" gorm:"uniqueIndex;size:40;not null"`
+	ClubID      string    `json:"club_id" gorm:"index;size:32"`
 	Status      string    `json:"status" gorm:"size:20;not null"`
 	NextRunAt   time.Time `json:"next_run_at"`
 	LastEventAt time.Time `json:"last_event_at"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// A running task belongs to ClaimedBy until LeaseExpiresAt. The worker
+	// renews the lease while it builds; once it expires the task can be
+	// claimed again, e.g. after the worker crashed.
+	ClaimedBy      string     `json:"claimed_by" gorm:"size:100"`
+	ClaimedAt      *time.Time `json:"claimed_at"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at" gorm:"index"`
 }
 
 type Store struct {
 	db             *gorm.DB
 	policyMu       sync.RWMutex
 	passwordPolicy PasswordPolicy
-}
 
-type PasswordPolicy struct {
-	MinLength int
+	buildEnqueued func()
 }
 
 type ClubUpdate struct {
@@ -165,37 +212,60 @@ func NewStore(path string) (*Store, error) {
 		return nil, err
 	}
 
-	if err := db.AutoMigrate(&User{}, &Club{}, &OpeningHour{}, &Course{}, &BuildTask{}); err != nil {
+	// Accounts that existed before e-mail verification was introduced are
+	// treated as verified so their clubs stay online.
+	backfillVerified := db.Migrator().HasTable(&User{}) && !db.Migrator().HasColumn(&User{}, "VerifiedAt")
+	// Likewise, clubs from before the draft workflow are published as they are.
+	backfillPublished := db.Migrator().HasTable(&Club{}) && !db.Migrator().HasColumn(&Club{}, "PublishedAt")
+
+	if err := db.AutoMigrate(&User{}, &Session{}, &Club{}, &ClubMembership{}, &OpeningHour{}, &Course{}, &BuildTask{}, &PasswordResetToken{}, &Setting{}, &RecoveryCode{}, &PlatformAction{}, &AuditEvent{}, &ClubRevision{}, &BuildRun{}, &Worker{}, &Leadership{}); err != nil {
 		return nil, err
 	}
 
+	if backfillVerified {
+		if err := db.Model(&User{}).Where("verified_at IS NULL").
+			Update("verified_at", gorm.Expr("created_at")).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := backfillMemberships(db); err != nil {
+		return nil, err
+	}
+	if backfillPublished {
+		if err := backfillPublications(db); err != nil {
+			return nil, err
+		}
+	}
+
 	return &Store{
-		db: db,
-		passwordPolicy: PasswordPolicy{
-			MinLength: minPasswordLength,
-		},
+		db:             db,
+		passwordPolicy: DefaultPasswordPolicy(),
 	}, nil
 }
 
-func (s *Store) SetPasswordPolicy(policy PasswordPolicy) {
-	s.policyMu.Lock()
-	defer s.policyMu.Unlock()
-
-	if policy.MinLength <= 0 {
-		policy.MinLength = minPasswordLength
+// Close releases the database handle. The store must not be used afterwards.
+func (s *Store) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
 	}
-	s.passwordPolicy = policy
+	return sqlDB.Close()
 }
 
 func (s *Store) CreateUser(email, password string) (User, error) {
 	cleanEmail := normalizeEmail(email)
 	if cleanEmail == "" {
-		return User{}, errors.New("email is required")
+		return User{}, ErrEmailRequired
 	}
-	if len(password) < s.minPasswordLength() {
-		return User{}, ErrPasswordTooShort
+	if err := s.validatePassword(cleanEmail, password); err != nil {
+		return User{}, err
 	}
+	return s.insertUser(cleanEmail, password)
+}
 
+// insertUser creates the account without checking the password policy.
+func (s *Store) insertUser(cleanEmail, password string) (User, error) {
 	var existing User
 	err := s.db.Select("id").Where("email = ?", cleanEmail).First(&existing).Error
 	if err == nil {
@@ -249,187 +319,324 @@ func (s *Store) GetUser(id string) (User, bool) {
 	return user, true
 }
 
-func (s *Store) GetClubByOwner(ownerID string) (Club, bool) {
+func (s *Store) MarkEmailVerified(userID, email string) error {
+	result := s.db.Model(&User{}).
+		Where("id = ? AND email = ?", userID, normalizeEmail(email)).
+		Update("verified_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEmailChanged
+	}
+	return nil
+}
+
+func (s *Store) GetClubForUser(userID string) (Club, bool) {
 	var club Club
 	if err := s.db.Preload("OpeningHours", orderOpeningHours).
 		Preload("Courses", orderCourses).
-		Where("owner_id = ?", ownerID).First(&club).Error; err != nil {
+		Where("id IN (?)", s.db.Model(&ClubMembership{}).Select("club_id").Where("user_id = ?", userID)).
+		First(&club).Error; err != nil {
 		return Club{}, false
 	}
 	return club, true
 }
 
-func (s *Store) UpsertClub(ownerID string, update ClubUpdate) (Club, error) {
+func (s *Store) UpsertClub(actor Actor, update ClubUpdate) (Club, error) {
+	var club Club
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		club, err = upsertClub(tx, actor, update, "")
+		return err
+	})
+	if err != nil {
+		return Club{}, err
+	}
+	return club, nil
+}
+
+// upsertClub derives the slug from the name unless slug asks for a specific
+// one; either way it is made unique.
+func upsertClub(tx *gorm.DB, actor Actor, update ClubUpdate, slug string) (Club, error) {
+	userID := actor.UserID
 	clean := sanitizeClubUpdate(update)
 	if clean.Name == "" {
 		return Club{}, ErrNameRequired
 	}
 
-	slugBase := slugify(clean.Name)
+	slugBase := slug
+	if slugBase == "" {
+		slugBase = slugify(clean.Name)
+	}
 	if slugBase == "" {
 		slugBase = "club"
 	}
 
-	var result Club
-	err := s.db.Transaction(func(tx *gorm.DB) error {
-		var existing Club
-		err := tx.Where("owner_id = ?", ownerID).First(&existing).Error
-		hasExisting := err == nil
-		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-			return err
-		}
-
-		currentID := ""
-		if hasExisting {
-			currentID = existing.ID
-		}
-
-		uniqueSlug, err := uniqueSlug(tx, currentID, slugBase)
-		if err != nil {
-			return err
-		}
+	var membership ClubMembership
+	err := tx.Where("user_id = ?", userID).First(&membership).Error
+	hasMembership := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return Club{}, err
+	}
+	if hasMembership && !membership.CanEditClub() {
+		return Club{}, ErrNotAllowed
+	}
 
-		now := time.Now().UTC()
-		if hasExisting {
-			existing.Name = clean.Name
-			existing.Description = clean.Description
-			existing.Categories = clean.Categories
-			existing.Slug = uniqueSlug
-
-			existing.ContactName = clean.ContactName
-			existing.ContactRole = clean.ContactRole
-			existing.ContactEmail = clean.ContactEmail
-			existing.ContactPhone = clean.ContactPhone
-			existing.ContactWebsite = clean.ContactWebsite
-			existing.AddressLine1 = clean.AddressLine1
-			existing.AddressLine2 = clean.AddressLine2
-			existing.AddressPostal = clean.AddressPostal
-			existing.AddressCity = clean.AddressCity
-			existing.AddressCountry = clean.AddressCountry
-
-			existing.UpdatedAt = now
-			if err := tx.Save(&existing).Error; err != nil {
-				return err
-			}
-			result = existing
-			return nil
+	var existing Club
+	hasExisting := false
+	if hasMembership {
+		if err := tx.First(&existing, "id = ?", membership.ClubID).Error; err != nil {
+			return Club{}, err
 		}
+		hasExisting = true
+	}
 
-		club := Club{
-			ID:          newID(),
-			OwnerID:     ownerID,
-			Name:        clean.Name,
-			Description: clean.Description,
-			Categories:  clean.Categories,
-			Slug:        uniqueSlug,
+	currentID := ""
+	var before []auditField
+	if hasExisting {
+		currentID = existing.ID
+		before = clubAuditFields(existing)
+	}
 
-			ContactName:    clean.ContactName,
-			ContactRole:    clean.ContactRole,
-			ContactEmail:   clean.ContactEmail,
-			ContactPhone:   clean.ContactPhone,
-			ContactWebsite: clean.ContactWebsite,
-			AddressLine1:   clean.AddressLine1,
-			AddressLine2:   clean.AddressLine2,
-			AddressPostal:  clean.AddressPostal,
-			AddressCity:    clean.AddressCity,
-			AddressCountry: clean.AddressCountry,
+	uniqueSlug, err := uniqueSlug(tx, currentID, slugBase)
+	if err != nil {
+		return Club{}, err
+	}
 
-			CreatedAt: now,
-			UpdatedAt: now,
+	now := time.Now().UTC()
+	if hasExisting {
+		existing.Name = clean.Name
+		existing.Description = clean.Description
+		existing.Categories = clean.Categories
+		existing.Slug = uniqueSlug
+
+		existing.ContactName = clean.ContactName
+		existing.ContactRole = clean.ContactRole
+		existing.ContactEmail = clean.ContactEmail
+		existing.ContactPhone = clean.ContactPhone
+		existing.ContactWebsite = clean.ContactWebsite
+		existing.AddressLine1 = clean.AddressLine1
+		existing.AddressLine2 = clean.AddressLine2
+		existing.AddressPostal = clean.AddressPostal
+		existing.AddressCity = clean.AddressCity
+		existing.AddressCountry = clean.AddressCountry
+
+		existing.UpdatedAt = now
+		if err := tx.Save(&existing).Error; err != nil {
+			return Club{}, err
 		}
-
-		if err := tx.Create(&club).Error; err != nil {
-			return err
+		if err := recordAuditEvent(tx, existing.ID, actor, AuditEntityClub,
+			diffFields(before, clubAuditFields(existing))); err != nil {
+			return Club{}, err
 		}
-		result = club
-		return nil
-	})
-	if err != nil {
-		return Club{}, err
+		return existing, nil
+	}
+
+	club := Club{
+		ID:          newID(),
+		OwnerID:     userID,
+		Name:        clean.Name,
+		Description: clean.Description,
+		Categories:  clean.Categories,
+		Slug:        uniqueSlug,
+
+		ContactName:    clean.ContactName,
+		ContactRole:    clean.ContactRole,
+		ContactEmail:   clean.ContactEmail,
+		ContactPhone:   clean.ContactPhone,
+		ContactWebsite: clean.ContactWebsite,
+		AddressLine1:   clean.AddressLine1,
+		AddressLine2:   clean.AddressLine2,
+		AddressPostal:  clean.AddressPostal,
+		AddressCity:    clean.AddressCity,
+		AddressCountry: clean.AddressCountry,
+
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	return result, nil
+	if err := tx.Create(&club).Error; err != nil {
+		return Club{}, err
+	}
+	if err := tx.Create(&ClubMembership{
+		ClubID: club.ID,
+		UserID: userID,
+		Role:   RoleOwner,
+	}).Error; err != nil {
+		return Club{}, err
+	}
+	if err := recordAuditEvent(tx, club.ID, actor, AuditEntityClub,
+		diffFields(nil, clubAuditFields(club))); err != nil {
+		return Club{}, err
+	}
+	return club, nil
 }
 
-func (s *Store) ReplaceOpeningHours(clubID string, hours []OpeningHourInput) error {
+func (s *Store) ReplaceOpeningHours(actor Actor, clubID string, hours []OpeningHourInput) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("club_id = ?", clubID).Delete(&OpeningHour{}).Error; err != nil {
-			return err
-		}
+		return replaceOpeningHours(tx, actor, clubID, hours)
+	})
+}
 
-		items := make([]OpeningHour, 0, len(hours))
-		for _, hour := range hours {
-			if hour.DayOfWeek < 1 || hour.DayOfWeek > 7 {
-				continue
-			}
-			opens := strings.TrimSpace(hour.OpensAt)
-			closes := strings.TrimSpace(hour.ClosesAt)
-			note := strings.TrimSpace(hour.Note)
-			if opens == "" && closes == "" && note == "" {
-				continue
-			}
-			items = append(items, OpeningHour{
-				ClubID:    clubID,
-				DayOfWeek: hour.DayOfWeek,
-				OpensAt:   opens,
-				ClosesAt:  closes,
-				Note:      note,
-			})
-		}
+func replaceOpeningHours(tx *gorm.DB, actor Actor, clubID string, hours []OpeningHourInput) error {
+	var previous []OpeningHour
+	if err := tx.Where("club_id = ?", clubID).Scopes(orderOpeningHours).Find(&previous).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("club_id = ?", clubID).Delete(&OpeningHour{}).Error; err != nil {
+		return err
+	}
 
-		if len(items) == 0 {
-			return nil
+	items := OpeningHoursFromInputs(clubID, hours)
+	if len(items) > 0 {
+		if err := tx.Create(&items).Error; err != nil {
+			return err
 		}
+	}
+	return recordAuditEvent(tx, clubID, actor, AuditEntityOpeningHours,
+		diffFields(openingHourAuditFields(previous), openingHourAuditFields(items)))
+}
 
-		return tx.Create(&items).Error
+func (s *Store) ReplaceCourses(actor Actor, clubID string, courses []CourseInput) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return replaceCourses(tx, actor, clubID, courses)
 	})
 }
 
-func (s *Store) ReplaceCourses(clubID string, courses []CourseInput) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("club_id = ?", clubID).Delete(&Course{}).Error; err != nil {
+func replaceCourses(tx *gorm.DB, actor Actor, clubID string, courses []CourseInput) error {
+	var previous []Course
+	if err := tx.Where("club_id = ?", clubID).Find(&previous).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("club_id = ?", clubID).Delete(&Course{}).Error; err != nil {
+		return err
+	}
+
+	items := CoursesFromInputs(clubID, courses)
+	if len(items) > 0 {
+		if err := tx.Create(&items).Error; err != nil {
 			return err
 		}
+	}
+	return recordAuditEvent(tx, clubID, actor, AuditEntityCourses,
+		diffFields(courseAuditFields(previous), courseAuditFields(items)))
+}
 
-		items := make([]Course, 0, len(courses))
-		for _, course := range courses {
-			title := strings.TrimSpace(course.Title)
-			if title == "" {
-				continue
-			}
-			day := course.DayOfWeek
-			if day < 1 || day > 7 {
-				continue
-			}
-			items = append(items, Course{
-				ClubID:      clubID,
-				DayOfWeek:   day,
-				Title:       title,
-				StartTime:   strings.TrimSpace(course.StartTime),
-				EndTime:     strings.TrimSpace(course.EndTime),
-				Location:    strings.TrimSpace(course.Location),
-				Instructor:  strings.TrimSpace(course.Instructor),
-				Level:       strings.TrimSpace(course.Level),
-				Description: strings.TrimSpace(course.Description),
-			})
-		}
-
-		if len(items) == 0 {
-			return nil
+// PreviewClub applies an unsaved update to a copy of club the same way
+// UpsertClub would, without touching the database.
+func PreviewClub(club Club, update ClubUpdate) Club {
+	clean := sanitizeClubUpdate(update)
+	club.Name = clean.Name
+	club.Description = clean.Description
+	club.Categories = clean.Categories
+	club.ContactName = clean.ContactName
+	club.ContactRole = clean.ContactRole
+	club.ContactEmail = clean.ContactEmail
+	club.ContactPhone = clean.ContactPhone
+	club.ContactWebsite = clean.ContactWebsite
+	club.AddressLine1 = clean.AddressLine1
+	club.AddressLine2 = clean.AddressLine2
+	club.AddressPostal = clean.AddressPostal
+	club.AddressCity = clean.AddressCity
+	club.AddressCountry = clean.AddressCountry
+	if club.Slug == "" {
+		club.Slug = slugify(clean.Name)
+	}
+	return club
+}
+
+// OpeningHoursFromInputs drops invalid and empty rows, as ReplaceOpeningHours
+// stores them.
+func OpeningHoursFromInputs(clubID string, hours []OpeningHourInput) []OpeningHour {
+	items := make([]OpeningHour, 0, len(hours))
+	for _, hour := range hours {
+		if hour.DayOfWeek < 1 || hour.DayOfWeek > 7 {
+			continue
 		}
+		opens := strings.TrimSpace(hour.OpensAt)
+		closes := strings.TrimSpace(hour.ClosesAt)
+		note := strings.TrimSpace(hour.Note)
+		if opens == "" && closes == "" && note == "" {
+			continue
+		}
+		items = append(items, OpeningHour{
+			ClubID:    clubID,
+			DayOfWeek: hour.DayOfWeek,
+			OpensAt:   opens,
+			ClosesAt:  closes,
+			Note:      note,
+		})
+	}
+	return items
+}
 
-		return tx.Create(&items).Error
-	})
+// CoursesFromInputs drops untitled and invalid rows, as ReplaceCourses stores
+// them.
+func CoursesFromInputs(clubID string, courses []CourseInput) []Course {
+	items := make([]Course, 0, len(courses))
+	for _, course := range courses {
+		title := strings.TrimSpace(course.Title)
+		if title == "" {
+			continue
+		}
+		day := course.DayOfWeek
+		if day < 1 || day > 7 {
+			continue
+		}
+		items = append(items, Course{
+			ClubID:      clubID,
+			DayOfWeek:   day,
+			Title:       title,
+			StartTime:   strings.TrimSpace(course.StartTime),
+			EndTime:     strings.TrimSpace(course.EndTime),
+			Location:    strings.TrimSpace(course.Location),
+			Instructor:  strings.TrimSpace(course.Instructor),
+			Level:       strings.TrimSpace(course.Level),
+			Description: strings.TrimSpace(course.Description),
+		})
+	}
+	return items
 }
 
+// AllClubs returns the published state of every club that may appear on the
+// public site. Drafts are never included.
 func (s *Store) AllClubs() []Club {
+	return s.publicClubs(s.db)
+}
+
+// PublicClubs is AllClubs restricted to the given IDs. IDs of clubs that must
+// not be public (anymore) are simply missing from the result.
+func (s *Store) PublicClubs(clubIDs []string) []Club {
+	if len(clubIDs) == 0 {
+		return []Club{}
+	}
+	return s.publicClubs(s.db.Where("id IN ?", clubIDs))
+}
+
+func (s *Store) publicClubs(query *gorm.DB) []Club {
 	var clubs []Club
-	if err := s.db.Preload("OpeningHours", orderOpeningHours).
-		Preload("Courses", orderCourses).
-		Order("name asc").Order("slug asc").Find(&clubs).Error; err != nil {
+	if err := query.Where("id IN (?)", verifiedOwnerClubIDs(s.db)).
+		Where("suspended_at IS NULL AND published_at IS NOT NULL").
+		Find(&clubs).Error; err != nil {
 		return []Club{}
 	}
-	return clubs
+
+	published := make([]Club, 0, len(clubs))
+	for _, club := range clubs {
+		view, err := publishedView(club)
+		if err != nil {
+			continue
+		}
+		published = append(published, view)
+	}
+	sort.Slice(published, func(i, j int) bool {
+		if published[i].Name != published[j].Name {
+			return published[i].Name < published[j].Name
+		}
+		return published[i].Slug < published[j].Slug
+	})
+	return published
 }
 
 func (s *Store) EnsureExampleClub() (ExampleSeed, bool, error) {
@@ -444,12 +651,16 @@ func (s *Store) EnsureExampleClub() (ExampleSeed, bool, error) {
 	}
 
 	email := "demo@club-portal.test"
-	password := "demo1234"
+	password := "Morgenrot-Probetraining-1922"
 
-	user, err := s.CreateUser(email, password)
+	// The configured policy may be stricter than the fixed seed password.
+	user, err := s.insertUser(email, password)
 	if err != nil {
 		return ExampleSeed{}, false, err
 	}
+	if err := s.MarkEmailVerified(user.ID, user.Email); err != nil {
+		return ExampleSeed{}, false, err
+	}
 
 	update := ClubUpdate{
 		Name:        "SV Morgenrot 1922",
@@ -469,7 +680,8 @@ func (s *Store) EnsureExampleClub() (ExampleSeed, bool, error) {
 		AddressCountry: "Deutschland",
 	}
 
-	club, err := s.UpsertClub(user.ID, update)
+	actor := Actor{UserID: user.ID}
+	club, err := s.UpsertClub(actor, update)
 	if err != nil {
 		return ExampleSeed{}, false, err
 	}
@@ -483,7 +695,7 @@ func (s *Store) EnsureExampleClub() (ExampleSeed, bool, error) {
 		{DayOfWeek: 6, OpensAt: "10:00", ClosesAt: "13:00"},
 		{DayOfWeek: 7, Note: "geschlossen"},
 	}
-	if err := s.ReplaceOpeningHours(club.ID, openingHours); err != nil {
+	if err := s.ReplaceOpeningHours(actor, club.ID, openingHours); err != nil {
 		return ExampleSeed{}, false, err
 	}
 
@@ -494,7 +706,10 @@ func (s *Store) EnsureExampleClub() (ExampleSeed, bool, error) {
 		{DayOfWeek: 4, Title: "Badminton Freies Spiel", StartTime: "19:00", EndTime: "20:30", Location: "Halle C", Instructor: "Team"},
 		{DayOfWeek: 6, Title: "Lauftreff", StartTime: "09:30", EndTime: "11:00", Location: "Parkrunde", Instructor: "Max Urban", Level: "Alle Level"},
 	}
-	if err := s.ReplaceCourses(club.ID, courses); err != nil {
+	if err := s.ReplaceCourses(actor, club.ID, courses); err != nil {
+		return ExampleSeed{}, false, err
+	}
+	if err := s.PublishClub(actor, club.ID); err != nil {
 		return ExampleSeed{}, false, err
 	}
 
@@ -509,19 +724,37 @@ func (s *Store) EnsureExampleClub() (ExampleSeed, bool, error) {
 	}, true, nil
 }
 
+// EnqueueBuildTask schedules a build of the whole site, e.g. after clubs were
+// deleted or templates changed.
 func (s *Store) EnqueueBuildTask(debounce time.Duration) error {
+	return s.enqueueBuildTask(buildTaskKey, "", debounce)
+}
+
+func (s *Store) EnqueueClubBuildTask(clubID string, debounce time.Duration) error {
+	return s.enqueueBuildTask(clubBuildKeyPrefix+clubID, clubID, debounce)
+}
+
+// OnBuildEnqueued registers fn to run after a build task was queued, so the
+// worker can be woken instead of waiting for its next poll. It has to be set
+// before the store is used.
+func (s *Store) OnBuildEnqueued(fn func()) {
+	s.buildEnqueued = fn
+}
+
+func (s *Store) enqueueBuildTask(key, clubID string, debounce time.Duration) error {
 	now := time.Now().UTC()
 	if debounce < 0 {
 		debounce = 0
 	}
 	next := now.Add(debounce)
 
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		var task BuildTask
-		err := tx.Where("key = ?", buildTaskKey).First(&task).Error
+		err := tx.Where("key = ?", key).First(&task).Error
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			task = BuildTask{
-				Key:         buildTaskKey,
+				Key:         key,
+				ClubID:      clubID,
 				Status:      buildStatusPending,
 				NextRunAt:   next,
 				LastEventAt: now,
@@ -534,77 +767,240 @@ func (s *Store) EnqueueBuildTask(debounce time.Duration) error {
 
 		task.NextRunAt = next
 		task.LastEventAt = now
-		if task.Status != buildStatusRunning {
+		if task.Status != buildStatusRunning || task.leaseExpired(now) {
 			task.Status = buildStatusPending
 		}
 
 		return tx.Save(&task).Error
 	})
+	if err == nil && s.buildEnqueued != nil {
+		s.buildEnqueued()
+	}
+	return err
 }
 
-func (s *Store) ClaimBuildTask(now time.Time) (BuildTask, bool, error) {
-	var task BuildTask
+// NextBuildTaskAt returns when the next build task becomes claimable: the
+// earliest NextRunAt of a pending task, or of a running one once its lease
+// expired. ok is false when nothing is queued.
+func (s *Store) NextBuildTaskAt() (time.Time, bool, error) {
+	var (
+		next time.Time
+		ok   bool
+	)
+
+	var pending BuildTask
+	err := s.db.Where("status = ?", buildStatusPending).Order("next_run_at asc").First(&pending).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return time.Time{}, false, err
+	}
+	if err == nil {
+		next, ok = pending.NextRunAt, true
+	}
+
+	var running []BuildTask
+	if err := s.db.Where("status = ?", buildStatusRunning).Find(&running).Error; err != nil {
+		return time.Time{}, false, err
+	}
+	for _, task := range running {
+		// A task without a lease is claimable as soon as it is due.
+		at := task.NextRunAt
+		if task.LeaseExpiresAt != nil && task.LeaseExpiresAt.After(at) {
+			at = *task.LeaseExpiresAt
+		}
+		if !ok || at.Before(next) {
+			next, ok = at, true
+		}
+	}
+
+	return next, ok, nil
+}
+
+// ClaimBuildTasks leases up to limit ready tasks to workerID, oldest first, so
+// a club that keeps publishing cannot starve the others. Running tasks whose
+// lease expired count as ready.
+func (s *Store) ClaimBuildTasks(workerID string, now time.Time, lease time.Duration, limit int) ([]BuildTask, error) {
+	if limit <= 0 {
+		limit = 1
+	}
+	expires := now.Add(lease)
+
+	var claimed []BuildTask
 	err := s.db.Transaction(func(tx *gorm.DB) error {
-		result := tx.Model(&BuildTask{}).
-			Where("key = ? AND status = ? AND next_run_at <= ?", buildTaskKey, buildStatusPending, now).
-			Updates(map[string]any{
-				"status": buildStatusRunning,
-			})
-		if result.Error != nil {
-			return result.Error
+		var ready []BuildTask
+		if err := tx.Scopes(claimableBuildTasks(now)).
+			Where("next_run_at <= ?", now).
+			Order("next_run_at asc").Order("id asc").
+			Limit(limit).
+			Find(&ready).Error; err != nil {
+			return err
 		}
-		if result.RowsAffected == 0 {
-			return gorm.ErrRecordNotFound
+
+		for _, task := range ready {
+			result := tx.Model(&BuildTask{}).
+				Scopes(claimableBuildTasks(now)).
+				Where("id = ?", task.ID).
+				Updates(map[string]any{
+					"status":           buildStatusRunning,
+					"claimed_by":       workerID,
+					"claimed_at":       now,
+					"lease_expires_at": expires,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+			task.Status = buildStatusRunning
+			task.ClaimedBy = workerID
+			task.ClaimedAt = &now
+			task.LeaseExpiresAt = &expires
+			claimed = append(claimed, task)
 		}
-		return tx.Where("key = ?", buildTaskKey).First(&task).Error
+		return nil
 	})
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return BuildTask{}, false, nil
-	}
 	if err != nil {
-		return BuildTask{}, false, err
+		return nil, err
 	}
-	return task, true, nil
+	return claimed, nil
 }
 
-func (s *Store) CompleteBuildTask(taskID uint) error {
-	now := time.Now().UTC()
-	var task BuildTask
-	if err := s.db.First(&task, taskID).Error; err != nil {
-		return err
+// RenewBuildLeases extends the leases workerID holds on taskIDs. It returns
+// ErrLeaseLost when another worker took over one of them.
+func (s *Store) RenewBuildLeases(workerID string, taskIDs []uint, lease time.Duration) error {
+	if len(taskIDs) == 0 {
+		return nil
 	}
-
-	if task.NextRunAt.After(now) {
-		task.Status = buildStatusPending
-	} else {
-		task.Status = buildStatusIdle
-		task.NextRunAt = time.Time{}
+	result := s.db.Model(&BuildTask{}).
+		Where("id IN ? AND claimed_by = ? AND status = ?", taskIDs, workerID, buildStatusRunning).
+		Update("lease_expires_at", time.Now().UTC().Add(lease))
+	if result.Error != nil {
+		return result.Error
 	}
+	if result.RowsAffected < int64(len(taskIDs)) {
+		return ErrLeaseLost
+	}
+	return nil
+}
 
-	return s.db.Save(&task).Error
+// ReclaimBuildTasks puts running tasks without a valid lease back into the
+// queue and fails the build runs their workers left behind. Workers call it
+// when they take over the build leadership to pick up what a crashed
+// predecessor was building.
+func (s *Store) ReclaimBuildTasks(now time.Time) (int64, error) {
+	var reclaimed int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var orphaned []BuildTask
+		if err := tx.Where("status = ?", buildStatusRunning).
+			Where("lease_expires_at IS NULL OR lease_expires_at < ?", now).
+			Find(&orphaned).Error; err != nil {
+			return err
+		}
+		if len(orphaned) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(orphaned))
+		workers := make([]string, 0, len(orphaned))
+		for _, task := range orphaned {
+			ids = append(ids, task.ID)
+			if task.ClaimedBy != "" {
+				workers = append(workers, task.ClaimedBy)
+			}
+		}
+
+		result := tx.Model(&BuildTask{}).Where("id IN ?", ids).Updates(map[string]any{
+			"status":           buildStatusPending,
+			"claimed_by":       "",
+			"claimed_at":       nil,
+			"lease_expires_at": nil,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		reclaimed = result.RowsAffected
+
+		if len(workers) == 0 {
+			return nil
+		}
+		return tx.Model(&BuildRun{}).
+			Where("status = ? AND worker_id IN ?", BuildRunRunning, workers).
+			Updates(map[string]any{
+				"status":      BuildRunFailed,
+				"error":       "worker stopped during the build",
+				"finished_at": now,
+			}).Error
+	})
+	return reclaimed, err
+}
+
+func (s *Store) CompleteBuildTask(workerID string, taskID uint) error {
+	now := time.Now().UTC()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var task BuildTask
+		if err := tx.First(&task, taskID).Error; err != nil {
+			return err
+		}
+		if task.ClaimedBy != workerID {
+			return ErrLeaseLost
+		}
+
+		// Changes queued while the build ran are not part of it yet.
+		changedSinceClaim := task.ClaimedAt != nil && task.LastEventAt.After(*task.ClaimedAt)
+		if task.NextRunAt.After(now) || changedSinceClaim {
+			task.Status = buildStatusPending
+		} else {
+			task.Status = buildStatusIdle
+			task.NextRunAt = time.Time{}
+		}
+		task.ClaimedBy = ""
+		task.ClaimedAt = nil
+		task.LeaseExpiresAt = nil
+
+		return tx.Save(&task).Error
+	})
 }
 
-func (s *Store) RescheduleBuildTask(taskID uint, delay time.Duration) error {
+func (s *Store) RescheduleBuildTask(workerID string, taskID uint, delay time.Duration) error {
 	if delay < 0 {
 		delay = 0
 	}
 	next := time.Now().UTC().Add(delay)
 
-	return s.db.Model(&BuildTask{}).
-		Where("id = ?", taskID).
+	result := s.db.Model(&BuildTask{}).
+		Where("id = ? AND claimed_by = ?", taskID, workerID).
 		Updates(map[string]any{
-			"status":      buildStatusPending,
-			"next_run_at": next,
-		}).Error
+			"status":           buildStatusPending,
+			"next_run_at":      next,
+			"claimed_by":       "",
+			"claimed_at":       nil,
+			"lease_expires_at": nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
 }
 
-func (s *Store) minPasswordLength() int {
-	s.policyMu.RLock()
-	defer s.policyMu.RUnlock()
-	if s.passwordPolicy.MinLength <= 0 {
-		return minPasswordLength
+func (t BuildTask) leaseExpired(now time.Time) bool {
+	return t.LeaseExpiresAt == nil || t.LeaseExpiresAt.Before(now)
+}
+
+func claimableBuildTasks(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("status = ? OR (status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?))",
+			buildStatusPending, buildStatusRunning, now)
 	}
-	return s.passwordPolicy.MinLength
+}
+
+func verifiedOwnerClubIDs(db *gorm.DB) *gorm.DB {
+	return db.Table("club_memberships").
+		Select("club_memberships.club_id").
+		Joins("JOIN users ON users.id = club_memberships.user_id").
+		Where("club_memberships.role = ? AND users.verified_at IS NOT NULL", RoleOwner)
 }
 
 func orderOpeningHours(db *gorm.DB) *gorm.DB {
@@ -686,7 +1082,7 @@ func uniqueSlug(tx *gorm.DB, currentClubID, desired string) (string, error) {
 
 	slug := base
 	for i := 2; ; i++ {
-		query := tx.Model(&Club{}).Where("slug = ?", slug)
+		query := tx.Model(&Club{}).Where("slug = ? OR published_slug = ?", slug, slug)
 		if currentClubID != "" {
 			query = query.Where("id <> ?", currentClubID)
 		}
@@ -709,6 +1105,14 @@ func newID() string {
 	return hex.EncodeToString(buf[:])
 }
 
+func newToken() string {
+	var buf [32]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf[:])
+}
+
 func normalizeEmail(email string) string {
 	return strings.ToLower(strings.TrimSpace(email))
 }
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+var (
+	ErrTOTPNotPending  = errors.New("no pending two-factor enrollment")
+	ErrTOTPReplay      = errors.New("two-factor code already used")
+	ErrInvalidRecovery = errors.New("invalid recovery code")
+)
+
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    string     `json:"user_id" gorm:"index;size:32;not null"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (s *Store) SetPendingTOTPSecret(userID, secret string) error {
+	return s.db.Model(&User{}).Where("id = ? AND totp_enabled_at IS NULL", userID).
+		Update("totp_secret", secret).Error
+}
+
+func (s *Store) EnableTOTP(userID string, step int64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		result := tx.Model(&User{}).
+			Where("id = ? AND totp_secret <> '' AND totp_enabled_at IS NULL", userID).
+			Updates(map[string]any{
+				"totp_enabled_at": now,
+				"totp_last_step":  step,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTOTPNotPending
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		items := make([]RecoveryCode, 0, recoveryCodeCount)
+		for i := 0; i < recoveryCodeCount; i++ {
+			code := newRecoveryCode()
+			codes = append(codes, code)
+			items = append(items, RecoveryCode{
+				UserID:    userID,
+				CodeHash:  hashToken(normalizeRecoveryCode(code)),
+				CreatedAt: now,
+			})
+		}
+		return tx.Create(&items).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (s *Store) DisableTOTP(userID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]any{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+func (s *Store) ConsumeTOTPStep(userID string, step int64) error {
+	result := s.db.Model(&User{}).
+		Where("id = ? AND totp_last_step < ?", userID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTOTPReplay
+	}
+	return nil
+}
+
+func (s *Store) UseRecoveryCode(userID, code string) error {
+	result := s.db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now().UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidRecovery
+	}
+	return nil
+}
+
+func (s *Store) RemainingRecoveryCodes(userID string) int64 {
+	var count int64
+	s.db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return count
+}
+
+func newRecoveryCode() string {
+	var buf [10]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		panic(err)
+	}
+	out := make([]byte, 0, 11)
+	for i, b := range buf {
+		if i == 5 {
+			out = append(out, '-')
+		}
+		out = append(out, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+	}
+	return string(out)
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LeaderBuild is the role of the worker that owns the nightly schedule and
+// runs the builds. All workers share OUTPUT_DIR, so only one of them may
+// write to it at a time.
+const LeaderBuild = "build"
+
+// Workers that have not sent a heartbeat for this long are dropped from the
+// registry the next time a worker registers.
+const workerRetention = 24 * time.Hour
+
+// Worker is a registry entry of a running cmd/worker process.
+type Worker struct {
+	ID          string    `json:"id" gorm:"primaryKey;size:100"`
+	Hostname    string    `json:"hostname" gorm:"size:255"`
+	PID         int       `json:"pid" gorm:"column:pid"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at" gorm:"index"`
+}
+
+// Leadership records which worker holds a role until ExpiresAt. The holder
+// keeps renewing it; once it lapses any other worker may take over.
+type Leadership struct {
+	Role       string    `json:"role" gorm:"primaryKey;size:50"`
+	WorkerID   string    `json:"worker_id" gorm:"size:100;not null"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (s *Store) RegisterWorker(id, hostname string, pid int) error {
+	now := time.Now().UTC()
+	worker := Worker{
+		ID:          id,
+		Hostname:    hostname,
+		PID:         pid,
+		StartedAt:   now,
+		HeartbeatAt: now,
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("heartbeat_at < ?", now.Add(-workerRetention)).Delete(&Worker{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"hostname", "pid", "started_at", "heartbeat_at"}),
+		}).Create(&worker).Error
+	})
+}
+
+// UnregisterWorker removes a worker that shuts down cleanly from the registry.
+func (s *Store) UnregisterWorker(id string) error {
+	return s.db.Where("id = ?", id).Delete(&Worker{}).Error
+}
+
+func (s *Store) WorkerHeartbeat(id string) error {
+	return s.db.Model(&Worker{}).Where("id = ?", id).
+		Update("heartbeat_at", time.Now().UTC()).Error
+}
+
+// Workers lists the registered workers, most recently started first.
+func (s *Store) Workers() ([]Worker, error) {
+	var workers []Worker
+	err := s.db.Order("started_at desc").Find(&workers).Error
+	return workers, err
+}
+
+// AcquireLeadership makes workerID the holder of role until now+ttl when the
+// role is free, expired or already held by workerID. Each check and write
+// happens in one statement, so two workers can never both win. takenOver is
+// false when workerID only renewed a lease it still held in the table, even
+// an expired one nobody else claimed in the meantime.
+func (s *Store) AcquireLeadership(role, workerID string, now time.Time, ttl time.Duration) (acquired, takenOver bool, err error) {
+	now = now.UTC()
+	expires := now.Add(ttl)
+
+	result := s.db.Model(&Leadership{}).
+		Where("role = ? AND worker_id = ?", role, workerID).
+		Update("expires_at", expires)
+	if result.Error != nil {
+		return false, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, false, nil
+	}
+
+	result = s.db.Model(&Leadership{}).
+		Where("role = ? AND expires_at < ?", role, now).
+		Updates(map[string]any{
+			"worker_id":   workerID,
+			"acquired_at": now,
+			"expires_at":  expires,
+		})
+	if result.Error != nil {
+		return false, false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, true, nil
+	}
+
+	leadership := Leadership{
+		Role:       role,
+		WorkerID:   workerID,
+		AcquiredAt: now,
+		ExpiresAt:  expires,
+	}
+	result = s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&leadership)
+	if result.Error != nil {
+		return false, false, result.Error
+	}
+	acquired = result.RowsAffected > 0
+	return acquired, acquired, nil
+}
+
+// ResignLeadership gives up role if workerID holds it, so a standby does not
+// have to wait for the lease to expire.
+func (s *Store) ResignLeadership(role, workerID string) error {
+	return s.db.Where("role = ? AND worker_id = ?", role, workerID).Delete(&Leadership{}).Error
+}
+
+// Leader returns the current holder of role. ok is false when nobody holds
+// it or the last lease has expired.
+func (s *Store) Leader(role string, now time.Time) (Leadership, bool, error) {
+	var leadership Leadership
+	err := s.db.Where("role = ?", role).First(&leadership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Leadership{}, false, nil
+	}
+	if err != nil {
+		return Leadership{}, false, err
+	}
+	if leadership.ExpiresAt.Before(now.UTC()) {
+		return leadership, false, nil
+	}
+	return leadership, true, nil
+}
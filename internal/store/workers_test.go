@@ -0,0 +1,50 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAcquireLeadershipTellsRenewalFromTakeOver(t *testing.T) {
+	s := newTestStore(t)
+	const ttl = 30 * time.Second
+	now := time.Now().UTC()
+
+	acquire := func(workerID string, at time.Time) (bool, bool) {
+		t.Helper()
+		acquired, takenOver, err := s.AcquireLeadership(LeaderBuild, workerID, at, ttl)
+		if err != nil {
+			t.Fatalf("AcquireLeadership(%s): %v", workerID, err)
+		}
+		return acquired, takenOver
+	}
+
+	if acquired, takenOver := acquire("worker-a", now); !acquired || !takenOver {
+		t.Fatalf("first acquire: acquired=%v takenOver=%v, want both", acquired, takenOver)
+	}
+	if acquired, _ := acquire("worker-b", now.Add(ttl/2)); acquired {
+		t.Fatal("worker-b acquired a lease worker-a still holds")
+	}
+	if acquired, takenOver := acquire("worker-a", now.Add(ttl/2)); !acquired || takenOver {
+		t.Fatalf("renewal: acquired=%v takenOver=%v, want a plain renewal", acquired, takenOver)
+	}
+
+	// A lapsed lease nobody else claimed is still worker-a's own.
+	lapsed := now.Add(3 * ttl)
+	if acquired, takenOver := acquire("worker-a", lapsed); !acquired || takenOver {
+		t.Fatalf("renewal after lapse: acquired=%v takenOver=%v, want a plain renewal", acquired, takenOver)
+	}
+
+	expired := lapsed.Add(2 * ttl)
+	if acquired, takenOver := acquire("worker-b", expired); !acquired || !takenOver {
+		t.Fatalf("take-over: acquired=%v takenOver=%v, want both", acquired, takenOver)
+	}
+	if acquired, _ := acquire("worker-a", expired); acquired {
+		t.Fatal("worker-a renewed a lease worker-b took over")
+	}
+
+	leader, ok, err := s.Leader(LeaderBuild, expired)
+	if err != nil || !ok || leader.WorkerID != "worker-b" {
+		t.Fatalf("Leader: %+v ok=%v err=%v, want worker-b", leader, ok, err)
+	}
+}
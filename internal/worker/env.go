@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/buildnotify"
+	"github.com/janmarkuslanger/club-portal/internal/site"
+)
+
+// ConfigFromEnv reads the worker settings from the environment, so cmd/worker
+// and the embedded worker of cmd/server are configured the same way. dataPath
+// is the store the worker uses; the notification socket lives next to it.
+func ConfigFromEnv(dataPath string) Config {
+	defaults := DefaultConfig()
+	return Config{
+		Options: site.BuildOptions{
+			OutputDir:   envOrDefault("OUTPUT_DIR", "public"),
+			TemplateDir: envOrDefault("TEMPLATE_DIR", filepath.Join("templates", "site")),
+			AssetDir:    envOrDefault("ASSET_DIR", filepath.Join("static", "site")),
+			Incremental: envBool("BUILD_INCREMENTAL", true),
+
+			KeepReleases: envInt("BUILD_KEEP_RELEASES", site.DefaultKeepReleases),
+		},
+		PollInterval:    envDuration("BUILD_POLL_INTERVAL", defaults.PollInterval),
+		RetryDelay:      envDuration("BUILD_RETRY_DELAY", defaults.RetryDelay),
+		NightlyAt:       envOrDefault("BUILD_NIGHTLY_AT", defaults.NightlyAt),
+		BatchSize:       envInt("BUILD_BATCH_SIZE", defaults.BatchSize),
+		Lease:           envDuration("BUILD_LEASE", defaults.Lease),
+		LeaderTTL:       envDuration("WORKER_LEADER_TTL", defaults.LeaderTTL),
+		RunRetention:    envDuration("BUILD_RUN_RETENTION", defaults.RunRetention),
+		NotifySocket:    envOrDefault("BUILD_NOTIFY_SOCKET", buildnotify.SocketPath(dataPath)),
+		ShutdownTimeout: envDuration("SHUTDOWN_TIMEOUT", defaults.ShutdownTimeout),
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func envBool(key string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
+func envInt(key string, fallback int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+// leaderElection keeps the worker's registry entry alive and competes for the
+// build leadership in the background, so a long build does not let the
+// leadership lapse.
+type leaderElection struct {
+	ID    string
+	Store *store.Store
+	TTL   time.Duration
+
+	leader atomic.Bool
+	// tookOver is set when the leadership was won from another worker or
+	// after a clean hand-over, rather than renewed, until TookOver reads it.
+	tookOver atomic.Bool
+	// expires is when the last lease this worker obtained runs out. Only the
+	// campaign touches it.
+	expires time.Time
+	changed chan struct{}
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+func (e *leaderElection) start() {
+	e.changed = make(chan struct{}, 1)
+	e.quit = make(chan struct{})
+	e.done = make(chan struct{})
+	e.campaign()
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.TTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-e.quit:
+				return
+			case <-ticker.C:
+				if err := e.Store.WorkerHeartbeat(e.ID); err != nil {
+					log.Printf("worker heartbeat failed: %v", err)
+				}
+				e.campaign()
+			}
+		}
+	}()
+}
+
+// stop ends the campaign and hands the leadership over right away instead of
+// letting a standby wait for the lease to run out.
+func (e *leaderElection) stop() {
+	close(e.quit)
+	<-e.done
+	e.leader.Store(false)
+	if err := e.Store.ResignLeadership(store.LeaderBuild, e.ID); err != nil {
+		log.Printf("resigning build leadership failed: %v", err)
+	}
+}
+
+func (e *leaderElection) campaign() {
+	now := time.Now()
+	elected, takenOver, err := e.Store.AcquireLeadership(store.LeaderBuild, e.ID, now, e.TTL)
+	switch {
+	case err != nil:
+		// Nobody can take over before the last lease runs out, so a failed
+		// renewal only ends the leadership once it has.
+		log.Printf("leader election failed: %v", err)
+		elected = now.Before(e.expires)
+	case elected:
+		e.expires = now.Add(e.TTL)
+		if takenOver {
+			e.tookOver.Store(true)
+		}
+	}
+	if e.leader.Swap(elected) != elected {
+		select {
+		case e.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Changed fires when the worker gained or lost the leadership.
+func (e *leaderElection) Changed() <-chan struct{} {
+	return e.changed
+}
+
+func (e *leaderElection) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// TookOver reports once whether the leadership changed hands since the last
+// call. A worker that merely renewed its own lease, even after it had lapsed,
+// has nothing to take over.
+func (e *leaderElection) TookOver() bool {
+	return e.tookOver.Swap(false)
+}
@@ -0,0 +1,233 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/site"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+var errLeadershipLost = errors.New("build leadership lost to another worker")
+
+func (w *Worker) processQueue(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return nil
+	}
+	tasks, err := w.store.ClaimBuildTasks(w.cfg.ID, time.Now().UTC(), w.cfg.Lease, w.cfg.BatchSize)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	scope, clubIDs := buildScope(tasks)
+	run, err := w.store.StartBuildRun(w.cfg.ID, scope, clubIDs)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("claimed %d build tasks", len(tasks))
+	graceCtx, cancelGrace := graceContext(ctx, w.cfg.ShutdownTimeout)
+	buildCtx, cancelBuild := context.WithCancelCause(graceCtx)
+	stopHeartbeat := w.heartbeat(tasks, cancelBuild)
+	result, buildErr := w.runBuild(buildCtx, scope, clubIDs, taskIDs(tasks))
+	stopHeartbeat()
+	leaseLost := errors.Is(context.Cause(buildCtx), store.ErrLeaseLost)
+	cancelBuild(nil)
+	cancelGrace()
+
+	retryDelay := w.cfg.RetryDelay
+	if errors.Is(buildErr, context.Canceled) {
+		// The release was discarded; whoever runs next builds it again.
+		buildErr = errors.New("build cancelled by worker shutdown")
+		if leaseLost {
+			buildErr = errors.New("build cancelled: lease lost to another worker")
+		}
+		retryDelay = 0
+	}
+	if errors.Is(buildErr, store.ErrLeaseLost) || errors.Is(buildErr, errLeadershipLost) {
+		// Someone else builds now; the release was discarded before it went
+		// live.
+		retryDelay = 0
+	}
+	if err := w.store.FinishBuildRun(run.ID, result, buildErr); err != nil {
+		log.Printf("failed to record build run: %v", err)
+	}
+	if buildErr != nil {
+		log.Printf("build failed: %v", buildErr)
+		for _, task := range tasks {
+			if err := w.store.RescheduleBuildTask(w.cfg.ID, task.ID, retryDelay); err != nil && !errors.Is(err, store.ErrLeaseLost) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, task := range tasks {
+		err := w.store.CompleteBuildTask(w.cfg.ID, task.ID)
+		if errors.Is(err, store.ErrLeaseLost) {
+			// Another worker took over after our lease ran out and builds
+			// the task again; nothing is lost.
+			log.Printf("build task %s was reclaimed by another worker", task.Key)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("build finished (%s, %d clubs: %d rendered, %d unchanged, %d removed)",
+		scope, result.ClubCount, result.Rendered, result.Skipped, result.Removed)
+	return nil
+}
+
+// graceContext is cancelled grace after parent, so a build that is running
+// when the worker is asked to stop gets a chance to finish.
+func graceContext(parent context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-parent.Done():
+		}
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+			log.Printf("build still running after %s, cancelling it", grace)
+			cancel()
+		}
+	}()
+	return ctx, cancel
+}
+
+// idle returns how long the worker may sleep: until the next queued task is
+// due or the nightly build starts, but no longer than the poll interval in
+// case a notification from the server got lost.
+func (w *Worker) idle(nextNightly time.Time) time.Duration {
+	poll := w.cfg.PollInterval
+	now := time.Now()
+	wait := poll
+	if until := nextNightly.Sub(now); until < wait {
+		wait = until
+	}
+
+	next, ok, err := w.store.NextBuildTaskAt()
+	if err != nil {
+		log.Printf("build queue lookup failed: %v", err)
+		return poll
+	}
+	if ok {
+		if until := next.Sub(now); until < wait {
+			wait = until
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// heartbeat renews the leases on tasks until the returned function is called,
+// so a long build is not mistaken for a crashed worker. Once another worker
+// has taken over a task it calls lost, which stops the build before it
+// activates a release that competes with the new owner's.
+func (w *Worker) heartbeat(tasks []store.BuildTask, lost context.CancelCauseFunc) func() {
+	ids := taskIDs(tasks)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(w.cfg.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				err := w.store.RenewBuildLeases(w.cfg.ID, ids, w.cfg.Lease)
+				if errors.Is(err, store.ErrLeaseLost) {
+					log.Println("build lease lost to another worker, cancelling the build")
+					lost(err)
+					return
+				}
+				if err != nil {
+					log.Printf("renewing build leases failed: %v", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// buildScope rebuilds the whole site when a global task was claimed and only
+// the affected club pages otherwise.
+func buildScope(tasks []store.BuildTask) (string, []string) {
+	clubIDs := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		if task.ClubID == "" {
+			return store.BuildScopeSite, nil
+		}
+		clubIDs = append(clubIDs, task.ClubID)
+	}
+	return store.BuildScopeClubs, clubIDs
+}
+
+func (w *Worker) runBuild(ctx context.Context, scope string, clubIDs []string, ids []uint) (store.BuildRunResult, error) {
+	var (
+		report site.BuildReport
+		err    error
+		result store.BuildRunResult
+	)
+	opts := w.cfg.Options
+	opts.BeforeActivate = func() error {
+		return w.checkOwnership(ids)
+	}
+	if scope == store.BuildScopeSite {
+		clubs := w.store.AllClubs()
+		result.ClubCount = len(clubs)
+		report, err = site.Build(ctx, clubs, opts)
+	} else {
+		result.ClubCount = len(clubIDs)
+		report, err = site.BuildClubs(ctx, clubIDs, w.store.PublicClubs(clubIDs), opts)
+	}
+
+	result.Rendered = report.Rendered
+	result.Skipped = report.Skipped
+	result.Removed = report.Removed
+	return result, err
+}
+
+// checkOwnership runs right before a release goes live. The heartbeat and the
+// election only notice a take-over every few seconds; this closes the gap so
+// a worker that lost the leadership or its leases never replaces the output
+// of the one that took over.
+func (w *Worker) checkOwnership(ids []uint) error {
+	leader, ok, err := w.store.Leader(store.LeaderBuild, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok || leader.WorkerID != w.cfg.ID {
+		return errLeadershipLost
+	}
+	return w.store.RenewBuildLeases(w.cfg.ID, ids, w.cfg.Lease)
+}
+
+func taskIDs(tasks []store.BuildTask) []uint {
+	ids := make([]uint, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	return ids
+}
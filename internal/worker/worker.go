@@ -0,0 +1,242 @@
+// Package worker runs the build loop: it elects a leader among the workers
+// sharing a database, claims queued build tasks and renders them with
+// internal/site. cmd/worker runs it on its own; cmd/server can embed it.
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/janmarkuslanger/club-portal/internal/buildnotify"
+	"github.com/janmarkuslanger/club-portal/internal/site"
+	"github.com/janmarkuslanger/club-portal/internal/store"
+)
+
+type Config struct {
+	// ID identifies the worker in the registry and on claimed tasks. It
+	// defaults to hostname-pid.
+	ID      string
+	Options site.BuildOptions
+
+	// PollInterval is only a safety net for builds queued without a
+	// notification; the worker normally sleeps until the next task is due.
+	PollInterval time.Duration
+	RetryDelay   time.Duration
+	// NightlyAt is the local time of the nightly full build as HH:MM.
+	NightlyAt    string
+	BatchSize    int
+	Lease        time.Duration
+	LeaderTTL    time.Duration
+	RunRetention time.Duration
+	// NotifySocket is where the leader listens for wake-ups from the server;
+	// empty disables it.
+	NotifySocket string
+	// ShutdownTimeout is how long a running build may still take once the
+	// worker is asked to stop.
+	ShutdownTimeout time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		PollInterval:    time.Minute,
+		RetryDelay:      5 * time.Minute,
+		NightlyAt:       "03:00",
+		BatchSize:       20,
+		Lease:           time.Minute,
+		LeaderTTL:       30 * time.Second,
+		RunRetention:    30 * 24 * time.Hour,
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+type Worker struct {
+	cfg   Config
+	store *store.Store
+	wake  chan struct{}
+}
+
+func New(storeInstance *store.Store, cfg Config) (*Worker, error) {
+	if storeInstance == nil {
+		return nil, errors.New("worker store is required")
+	}
+	defaults := DefaultConfig()
+	if cfg.ID == "" {
+		cfg.ID = workerID()
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaults.PollInterval
+	}
+	if cfg.NightlyAt == "" {
+		cfg.NightlyAt = defaults.NightlyAt
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = defaults.Lease
+	}
+	if cfg.LeaderTTL <= 0 {
+		cfg.LeaderTTL = defaults.LeaderTTL
+	}
+	if _, err := nextNightlyRun(time.Now(), cfg.NightlyAt); err != nil {
+		return nil, err
+	}
+
+	return &Worker{
+		cfg:   cfg,
+		store: storeInstance,
+		wake:  make(chan struct{}, 1),
+	}, nil
+}
+
+// Wake makes the worker look at the queue right away. It is the in-process
+// counterpart of a notification over the socket.
+func (w *Worker) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes the build queue until ctx is done and then gives up the
+// leadership and leaves the registry. The store stays open.
+func (w *Worker) Run(ctx context.Context) error {
+	hostname, _ := os.Hostname()
+	if err := w.store.RegisterWorker(w.cfg.ID, hostname, os.Getpid()); err != nil {
+		return err
+	}
+	election := &leaderElection{ID: w.cfg.ID, Store: w.store, TTL: w.cfg.LeaderTTL}
+	election.start()
+
+	log.Printf("build worker %s started (nightly at %s)", w.cfg.ID, w.cfg.NightlyAt)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var (
+		leading      bool
+		listener     *buildnotify.Listener
+		notified     <-chan struct{}
+		nextNightly  time.Time
+		nextRunPrune time.Time
+		err          error
+	)
+	for ctx.Err() == nil {
+		now := time.Now()
+		if election.IsLeader() != leading {
+			leading = !leading
+			if !leading {
+				log.Println("lost build leadership, standing by")
+				if listener != nil {
+					listener.Close()
+				}
+				listener, notified = nil, nil
+			} else {
+				log.Println("holding build leadership")
+				// Only the leader listens, so the server always wakes the
+				// worker that actually builds.
+				if w.cfg.NotifySocket != "" {
+					listener, err = buildnotify.Listen(w.cfg.NotifySocket)
+					if err != nil {
+						log.Printf("build notifications unavailable, polling every %s: %v", w.cfg.PollInterval, err)
+					} else {
+						notified = listener.C()
+					}
+				}
+				nextNightly, _ = nextNightlyRun(now, w.cfg.NightlyAt)
+			}
+		}
+		if leading && election.TookOver() {
+			log.Println("took over build leadership")
+			w.takeOver(now)
+		}
+
+		wait := w.cfg.PollInterval
+		if leading {
+			if now.After(nextNightly) || now.Equal(nextNightly) {
+				if err := w.store.EnqueueBuildTask(0); err != nil {
+					log.Printf("nightly enqueue failed: %v", err)
+				} else {
+					log.Println("nightly build enqueued")
+				}
+				nextNightly, _ = nextNightlyRun(now.Add(time.Minute), w.cfg.NightlyAt)
+			}
+
+			if err := w.processQueue(ctx); err != nil {
+				log.Printf("build queue error: %v", err)
+			} else {
+				wait = w.idle(nextNightly)
+			}
+			if now.After(nextRunPrune) {
+				if _, err := w.store.PruneBuildRuns(now.UTC().Add(-w.cfg.RunRetention)); err != nil {
+					log.Printf("build run prune failed: %v", err)
+				}
+				nextRunPrune = now.Add(time.Hour)
+			}
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-notified:
+		case <-w.wake:
+		case <-election.Changed():
+		case <-ctx.Done():
+		}
+	}
+
+	log.Printf("build worker %s shutting down", w.cfg.ID)
+	if listener != nil {
+		listener.Close()
+	}
+	election.stop()
+	return w.store.UnregisterWorker(w.cfg.ID)
+}
+
+// takeOver runs when the worker becomes the build leader, on start-up or
+// after the previous leader stopped renewing its lease.
+func (w *Worker) takeOver(now time.Time) {
+	if reclaimed, err := w.store.ReclaimBuildTasks(now.UTC()); err != nil {
+		log.Printf("reclaiming orphaned build tasks failed: %v", err)
+	} else if reclaimed > 0 {
+		log.Printf("reclaimed %d orphaned build tasks", reclaimed)
+	}
+
+	// A full build picks up template and asset changes of a deploy; per-club
+	// builds only re-render the clubs they were queued for.
+	if err := w.store.EnqueueBuildTask(0); err != nil {
+		log.Printf("full build enqueue failed: %v", err)
+	}
+}
+
+func workerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+func nextNightlyRun(now time.Time, at string) (time.Time, error) {
+	parts := strings.Split(at, ":")
+	if len(parts) != 2 {
+		return time.Time{}, fmt.Errorf("nightly build time %q must be HH:MM", at)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return time.Time{}, fmt.Errorf("nightly build time %q: hour invalid", at)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return time.Time{}, fmt.Errorf("nightly build time %q: minute invalid", at)
+	}
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.Add(24 * time.Hour)
+	}
+	return next, nil
+}